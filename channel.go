@@ -0,0 +1,134 @@
+package minibus
+
+import (
+	"context"
+	"reflect"
+)
+
+// Channel configures the calling function to receive messages of type M, and
+// returns a channel on which those messages are received.
+//
+// It allows a function to receive messages of a specific type without any type
+// assertions, for example:
+//
+//	for m := range minibus.Channel[MyMessage](ctx) {
+//		...
+//	}
+//
+// A function may call Channel several times with different types. Each message
+// is placed on the first channel whose type it's assignable to, so the channels
+// should be received from concurrently. A function that uses Channel must not
+// receive messages by any other means, such as [Receive] or [Inbox].
+//
+// The channel is closed when the function's inbox is closed, when the function
+// calls [Stop], or when it returns.
+//
+// It may only be called within a function that has been called by [Run]. It
+// must be called before [Ready].
+func Channel[M any](ctx context.Context) <-chan M {
+	f := caller(ctx)
+	if f.ReadySignal == nil {
+		panic("minibus: Channel() must not be called after calling Ready()")
+	}
+
+	f.Subscribe(ctx, reflect.TypeFor[M](), nil)
+
+	ch := make(chan M)
+	f.addChannel(channelOf[M](ch))
+
+	return ch
+}
+
+// typedChannel is a channel returned by [Channel].
+type typedChannel interface {
+	// Deliver places m on the channel if it's assignable to the channel's
+	// element type. It returns false if it is not.
+	Deliver(f *function, m any) bool
+
+	// Close closes the channel.
+	Close()
+}
+
+// channelOf is a [typedChannel] with an element type of M.
+type channelOf[M any] chan M
+
+func (c channelOf[M]) Deliver(f *function, m any) bool {
+	v, ok := m.(M)
+	if !ok {
+		return false
+	}
+
+	select {
+	case <-f.ReturnLatch:
+	case <-f.StopLatch:
+	case c <- v:
+	}
+
+	return true
+}
+
+func (c channelOf[M]) Close() {
+	close(c)
+}
+
+// addChannel adds a typed channel to the function, starting the goroutine that
+// feeds the typed channels if it's not already running.
+func (f *function) addChannel(c typedChannel) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.channelsClosed {
+		c.Close()
+		return
+	}
+
+	f.channels = append(f.channels, c)
+
+	if len(f.channels) > 1 {
+		return
+	}
+
+	f.Background.Add(1)
+
+	go func() {
+		defer f.Background.Done()
+		defer f.closeChannels()
+
+		for {
+			select {
+			case <-f.ReturnLatch:
+				return
+			case <-f.StopLatch:
+				return
+			case env, ok := <-f.Inbox:
+				if !ok {
+					return
+				}
+
+				m := f.Receive(env)
+
+				f.m.Lock()
+				channels := f.channels
+				f.m.Unlock()
+
+				for _, c := range channels {
+					if c.Deliver(f, m) {
+						break
+					}
+				}
+			}
+		}
+	}()
+}
+
+// closeChannels closes all of the typed channels returned by [Channel].
+func (f *function) closeChannels() {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.channelsClosed = true
+
+	for _, c := range f.channels {
+		c.Close()
+	}
+}
@@ -0,0 +1,115 @@
+package minibus_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestChannel(t *testing.T) {
+	t.Run("it delivers messages of the given type on the channel returned by Channel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		want := []int{1, 2, 3}
+		var got []int
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					messages := Channel[int](ctx)
+					Ready(ctx)
+
+					for m := range messages {
+						got = append(got, m)
+						if len(got) == len(want) {
+							return nil
+						}
+					}
+
+					return ctx.Err()
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Broadcast(ctx, 1, 2, 3)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("it delivers messages of each type on separate channels when Channel is called more than once", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var (
+			ints  []int
+			texts []string
+		)
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					intChan := Channel[int](ctx)
+					stringChan := Channel[string](ctx)
+					Ready(ctx)
+
+					var g errgroup.Group
+
+					g.Go(func() error {
+						for m := range intChan {
+							ints = append(ints, m)
+							if len(ints) == 2 {
+								return nil
+							}
+						}
+						return ctx.Err()
+					})
+
+					g.Go(func() error {
+						for m := range stringChan {
+							texts = append(texts, m)
+							if len(texts) == 2 {
+								return nil
+							}
+						}
+						return ctx.Err()
+					})
+
+					return g.Wait()
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Broadcast(ctx, 1, "<one>", "<two>", 2)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if want := []int{1, 2}; !slices.Equal(ints, want) {
+			t.Fatalf("unexpected int messages: got %v, want %v", ints, want)
+		}
+
+		if want := []string{"<one>", "<two>"}; !slices.Equal(texts, want) {
+			t.Fatalf("unexpected string messages: got %v, want %v", texts, want)
+		}
+	})
+}
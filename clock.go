@@ -0,0 +1,22 @@
+package minibus
+
+import "time"
+
+// Clock is an interface for a source of time.
+//
+// It allows time-based behavior, such as the pacing performed by
+// [IngestPaced], to be controlled by tests. See [WithClock].
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel that receives the current time once d has
+	// elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the [Clock] implementation used when [WithClock] is not used.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
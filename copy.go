@@ -0,0 +1,119 @@
+package minibus
+
+import "reflect"
+
+// DeepCopy returns a deep copy of m. It's intended for use with the
+// [WithMessageCopy] option.
+//
+// It recursively copies the values referred to by pointers, interfaces, slices
+// and maps, and the exported fields of structs. Unexported fields, channels
+// and functions are copied shallowly, so the copy may still share state with
+// m through them. Cycles of pointers are preserved in the copy.
+func DeepCopy(m any) any {
+	if m == nil {
+		return nil
+	}
+
+	return deepCopy(reflect.ValueOf(m), map[pointerKey]reflect.Value{}).Interface()
+}
+
+// pointerKey identifies a pointer that has already been copied by [deepCopy].
+type pointerKey struct {
+	Type    reflect.Type
+	Address uintptr
+}
+
+// deepCopy returns a deep copy of v. seen is the set of pointers that have
+// already been copied, mapped to their copies.
+func deepCopy(v reflect.Value, seen map[pointerKey]reflect.Value) reflect.Value {
+	t := v.Type()
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+
+		k := pointerKey{t, v.Pointer()}
+		if c, ok := seen[k]; ok {
+			return c
+		}
+
+		c := reflect.New(t.Elem())
+		seen[k] = c
+		c.Elem().Set(deepCopy(v.Elem(), seen))
+
+		return c
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.New(t).Elem()
+		c.Set(deepCopy(v.Elem(), seen))
+
+		return c
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := range v.Len() {
+			c.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+
+		return c
+
+	case reflect.Array:
+		c := reflect.New(t).Elem()
+		for i := range v.Len() {
+			c.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+
+		return c
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeMapWithSize(t, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			c.SetMapIndex(
+				deepCopy(iter.Key(), seen),
+				deepCopy(iter.Value(), seen),
+			)
+		}
+
+		return c
+
+	case reflect.Struct:
+		c := reflect.New(t).Elem()
+		c.Set(v)
+
+		for i := range v.NumField() {
+			if f := c.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i), seen))
+			}
+		}
+
+		return c
+
+	default:
+		return v
+	}
+}
+
+// copyMessage returns v, which is a message or an [envelope], with its message
+// replaced by a copy, as per the [WithMessageCopy] option.
+func (f *function) copyMessage(v any) any {
+	if env, ok := v.(envelope); ok {
+		env.Message = f.Config.Copy(env.Message)
+		return env
+	}
+
+	return f.Config.Copy(v)
+}
@@ -0,0 +1,141 @@
+package minibus_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+type copyMessage struct {
+	Value  string
+	Slice  []int
+	Map    map[string]*int
+	Next   *copyMessage
+	hidden *int
+}
+
+func TestDeepCopy(t *testing.T) {
+	t.Run("it copies the values referred to by pointers, slices and maps", func(t *testing.T) {
+		n := 1
+		m := &copyMessage{
+			Value: "<value>",
+			Slice: []int{1, 2, 3},
+			Map:   map[string]*int{"n": &n},
+		}
+
+		c := DeepCopy(m).(*copyMessage)
+
+		if !reflect.DeepEqual(c, m) {
+			t.Fatalf("unexpected copy: got %#v, want %#v", c, m)
+		}
+
+		m.Value = "<modified>"
+		m.Slice[0] = 100
+		*m.Map["n"] = 100
+
+		want := &copyMessage{
+			Value: "<value>",
+			Slice: []int{1, 2, 3},
+			Map:   map[string]*int{"n": new(int)},
+		}
+		*want.Map["n"] = 1
+
+		if !reflect.DeepEqual(c, want) {
+			t.Fatalf("copy shares data with the original: got %#v, want %#v", c, want)
+		}
+	})
+
+	t.Run("it preserves cycles", func(t *testing.T) {
+		m := &copyMessage{}
+		m.Next = m
+
+		c := DeepCopy(m).(*copyMessage)
+
+		if c == m {
+			t.Fatal("expected a new pointer")
+		}
+
+		if c.Next != c {
+			t.Fatal("expected the cycle to be preserved")
+		}
+	})
+
+	t.Run("it copies unexported fields shallowly", func(t *testing.T) {
+		n := 1
+		m := copyMessage{hidden: &n}
+
+		c := DeepCopy(m).(copyMessage)
+
+		if c.hidden != m.hidden {
+			t.Fatal("expected the unexported field to be copied shallowly")
+		}
+	})
+
+	t.Run("it returns nil when given nil", func(t *testing.T) {
+		if c := DeepCopy(nil); c != nil {
+			t.Fatalf("unexpected copy: got %#v, want nil", c)
+		}
+	})
+}
+
+func TestWithMessageCopy(t *testing.T) {
+	t.Run("it delivers a copy of the message as it was when it was sent", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var got []int
+
+		err := Run(
+			ctx,
+			WithMessageCopy(DeepCopy),
+			WithOutboxBuffer(1),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[[]int](ctx)
+					Ready(ctx)
+
+					m, err := Receive(ctx)
+					if err != nil {
+						return err
+					}
+
+					got = m.([]int)
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					m := []int{1, 2, 3}
+					if err := Send(ctx, m); err != nil {
+						return err
+					}
+
+					m[0] = 100
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected message: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("it panics if the function is nil", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic")
+			}
+		}()
+
+		WithMessageCopy(nil)
+	})
+}
@@ -0,0 +1,54 @@
+package minibus
+
+import (
+	"context"
+	"reflect"
+)
+
+// DeadLetter is a message that describes another message that was sent but
+// had no recipients.
+//
+// Functions can subscribe to DeadLetter like any other message type, such as to
+// log or retry undeliverable messages. A DeadLetter that itself has no
+// recipients is discarded, rather than producing another DeadLetter.
+type DeadLetter struct {
+	// Message is the message that had no recipients.
+	Message any
+
+	// Type is the type that the message was routed as, which may differ from
+	// the message's dynamic type, such as when it's sent using [SendAs].
+	Type reflect.Type
+
+	// Sender is the name of the function that sent the message.
+	Sender string
+}
+
+// deadLetterType is the [reflect.Type] of [DeadLetter].
+var deadLetterType = reflect.TypeFor[DeadLetter]()
+
+// deadLetter handles env, which was sent by f, but has no recipients.
+func (f *function) deadLetter(ctx context.Context, env envelope) bool {
+	if env.Type == deadLetterType {
+		return true
+	}
+
+	f.Config.Stats.MessageDropped(f.Name, env.Type)
+	f.emit(MessageDropped{env.Type})
+
+	if f.Config.DeadLetter != nil {
+		f.Config.DeadLetter(ctx, env.Message)
+	}
+
+	return f.route(
+		ctx,
+		envelope{
+			Type: deadLetterType,
+			Message: DeadLetter{
+				Message: env.Message,
+				Type:    env.Type,
+				Sender:  f.Name,
+			},
+			Sender: f,
+		},
+	)
+}
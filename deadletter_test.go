@@ -0,0 +1,142 @@
+package minibus_test
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestWithDeadLetter(t *testing.T) {
+	t.Run("it passes messages with no recipients to the dead-letter function", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var dead []any
+
+		err := Run(
+			ctx,
+			WithDeadLetter(
+				func(_ context.Context, m any) {
+					dead = append(dead, m)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+					return Send(ctx, "<message>")
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if len(dead) != 1 || dead[0] != "<message>" {
+			t.Fatalf("unexpected dead-letters: got %v, want [<message>]", dead)
+		}
+	})
+
+	t.Run("it does not pass messages with interface subscribers to the dead-letter function", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var dead []any
+
+		err := Run(
+			ctx,
+			WithDeadLetter(
+				func(_ context.Context, m any) {
+					dead = append(dead, m)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[io.Reader](ctx)
+					Ready(ctx)
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, &reader{"<message>"})
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if len(dead) != 0 {
+			t.Fatalf("unexpected dead-letters: %v", dead)
+		}
+	})
+}
+
+func TestDeadLetter(t *testing.T) {
+	t.Run("it sends a DeadLetter for each message with no recipients", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var (
+			dead     []any
+			received DeadLetter
+		)
+
+		err := Run(
+			ctx,
+			WithDeadLetter(
+				func(_ context.Context, m any) {
+					dead = append(dead, m)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[DeadLetter](ctx)
+					Ready(ctx)
+
+					var err error
+					received, err = ReceiveAs[DeadLetter](ctx)
+					return err
+				},
+			),
+			WithNamedFunc(
+				"<sender>",
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, "<message>")
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		want := DeadLetter{
+			Message: "<message>",
+			Type:    reflect.TypeFor[string](),
+			Sender:  "<sender>",
+		}
+
+		if received != want {
+			t.Fatalf("unexpected dead-letter: got %+v, want %+v", received, want)
+		}
+
+		if len(dead) != 1 || dead[0] != "<message>" {
+			t.Fatalf("unexpected dead-letters: got %v, want [<message>]", dead)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package minibus
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrDeadlock is returned by [Run] when the [WithDeadlockDetection] option is
+// used and every running function is blocked receiving a message that can
+// never arrive.
+var ErrDeadlock = errors.New("minibus: deadlock detected, all functions are blocked receiving messages")
+
+// deadlockDetector tracks the number of functions that are blocked receiving
+// messages, and the number of messages that are yet to be received, in order
+// to detect when a session can make no further progress.
+//
+// Its methods may be called on a nil pointer, in which case they do nothing.
+type deadlockDetector struct {
+	m sync.Mutex
+
+	// Receiving is the number of functions that are blocked in [Receive] (or a
+	// helper that blocks in the same way).
+	Receiving int
+
+	// Pending is the number of messages that have been sent but are yet to be
+	// delivered, plus the number of messages in inboxes that are yet to be
+	// received.
+	Pending int
+
+	// IsDisabled is true if detection has been disabled because a function
+	// writes to its outbox directly, bypassing the accounting in [Send].
+	IsDisabled bool
+
+	// Signal is sent a value when the detector may have entered a deadlocked
+	// state. It has a buffer of one.
+	Signal chan struct{}
+}
+
+// BeginReceive records that a function is blocked receiving a message.
+func (d *deadlockDetector) BeginReceive() {
+	if d == nil {
+		return
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.Receiving++
+	d.notify()
+}
+
+// EndReceive records that a function is no longer blocked receiving a message.
+func (d *deadlockDetector) EndReceive() {
+	if d == nil {
+		return
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.Receiving--
+}
+
+// Add adds n to the number of pending messages.
+func (d *deadlockDetector) Add(n int) {
+	if d == nil {
+		return
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.Pending += n
+	d.notify()
+}
+
+// Disable permanently disables deadlock detection.
+func (d *deadlockDetector) Disable() {
+	if d == nil {
+		return
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.IsDisabled = true
+}
+
+// IsDeadlocked returns true if all of the given number of running functions
+// are blocked receiving, and there are no pending messages.
+func (d *deadlockDetector) IsDeadlocked(running int) bool {
+	if d == nil {
+		return false
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	return !d.IsDisabled &&
+		running > 0 &&
+		d.Receiving == running &&
+		d.Pending == 0
+}
+
+// notify signals that the detector may be deadlocked. d.m must be held.
+func (d *deadlockDetector) notify() {
+	if d.Receiving == 0 || d.Pending != 0 {
+		return
+	}
+
+	select {
+	case d.Signal <- struct{}{}:
+	default:
+	}
+}
+
+// beginReceive records that f is about to block receiving a message using ctx,
+// if the block can only be ended by a message arriving or the session shutting
+// down. It returns true if [function.endReceive] must be called.
+func (f *function) beginReceive(ctx context.Context) bool {
+	if f.Deadlock == nil || ctx.Done() != f.SessionDone {
+		return false
+	}
+
+	f.Deadlock.BeginReceive()
+	return true
+}
+
+// endReceive records that f is no longer blocked receiving a message, if
+// receiving is true.
+func (f *function) endReceive(receiving bool) {
+	if receiving {
+		f.Deadlock.EndReceive()
+	}
+}
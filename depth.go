@@ -0,0 +1,75 @@
+package minibus
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrQueueFull is returned by [Send] and its variants when the
+// [WithMaxQueueDepth] option is used and the session already holds the maximum
+// number of undelivered messages of the message's type.
+var ErrQueueFull = errors.New("minibus: too many undelivered messages of this type")
+
+// queueDepth is the number of undelivered messages of a particular type, as
+// per [WithMaxQueueDepth].
+//
+// Its methods may be called on a nil pointer, in which case they do nothing.
+type queueDepth struct {
+	Max int64
+	n   atomic.Int64
+
+	// released is closed, and replaced, each time the depth is reduced. It's
+	// protected by m.
+	m        sync.Mutex
+	released chan struct{}
+}
+
+// TryAdd increments the depth by one, unless it's already at the maximum. It
+// returns false if the depth was not incremented.
+func (q *queueDepth) TryAdd() bool {
+	if q == nil {
+		return true
+	}
+
+	for {
+		n := q.n.Load()
+		if n >= q.Max {
+			return false
+		}
+		if q.n.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// Add adds n to the depth.
+func (q *queueDepth) Add(n int) {
+	if q == nil {
+		return
+	}
+
+	q.n.Add(int64(n))
+
+	if n < 0 {
+		q.m.Lock()
+		if q.released != nil {
+			close(q.released)
+			q.released = nil
+		}
+		q.m.Unlock()
+	}
+}
+
+// Released returns a channel that is closed the next time the depth is
+// reduced.
+func (q *queueDepth) Released() <-chan struct{} {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if q.released == nil {
+		q.released = make(chan struct{})
+	}
+
+	return q.released
+}
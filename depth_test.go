@@ -0,0 +1,389 @@
+package minibus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestWithMaxQueueDepth(t *testing.T) {
+	t.Run("it rejects messages of a type that has reached the depth configured by WithMaxQueueDepth", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		full := make(chan struct{})
+		drained := make(chan struct{})
+
+		err := Run(
+			ctx,
+			WithInboxBuffer(10),
+			WithMaxQueueDepth[int](2),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					<-full
+
+					for range 2 {
+						if _, err := Receive(ctx); err != nil {
+							return err
+						}
+					}
+					close(drained)
+
+					for range 2 {
+						if _, err := Receive(ctx); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := Broadcast(ctx, 1, 2); err != nil {
+						return err
+					}
+
+					if err := Send(ctx, 3); !errors.Is(err, ErrQueueFull) {
+						return fmt.Errorf("unexpected error: got %v, want %q", err, ErrQueueFull)
+					}
+
+					// Messages of other types are unaffected.
+					if err := Send(ctx, "<message>"); err != nil {
+						return err
+					}
+
+					close(full)
+					<-drained
+
+					return Send(ctx, 3)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it releases messages left in the inbox of a function that returns", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		sent := make(chan struct{})
+
+		err := Run(
+			ctx,
+			WithInboxBuffer(2),
+			WithMaxQueueDepth[int](1),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					// Return without receiving the message in the inbox.
+					<-sent
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					for range 2 {
+						if _, err := Receive(ctx); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := SendSync(ctx, 1); err != nil {
+						return err
+					}
+					close(sent)
+
+					for {
+						err := Send(ctx, 2)
+						if !errors.Is(err, ErrQueueFull) {
+							return err
+						}
+
+						select {
+						case <-ctx.Done():
+							return ctx.Err()
+						case <-time.After(1 * time.Millisecond):
+						}
+					}
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it releases messages left in the inbox of a function that stops", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		sent := make(chan struct{})
+		done := make(chan struct{})
+
+		err := Run(
+			ctx,
+			WithInboxBuffer(2),
+			WithMaxQueueDepth[int](1),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					<-sent
+					Stop(ctx)
+
+					// Keep running until the producer has managed to send
+					// again, so that the message is only released by Stop().
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-done:
+						return nil
+					}
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := SendSync(ctx, 1); err != nil {
+						return err
+					}
+					close(sent)
+
+					for {
+						err := Send(ctx, 2)
+						if err == nil {
+							close(done)
+						}
+						if !errors.Is(err, ErrQueueFull) {
+							return err
+						}
+
+						select {
+						case <-ctx.Done():
+							return ctx.Err()
+						case <-time.After(1 * time.Millisecond):
+						}
+					}
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+}
+
+func TestSendRetry(t *testing.T) {
+	t.Run("it retries while the queue is full", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		clock := newManualClock()
+
+		err := Run(
+			ctx,
+			WithClock(clock),
+			WithMaxQueueDepth[int](1),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					// Each attempt fails until the first message is received.
+					for _, wait := range []time.Duration{
+						10 * time.Millisecond,
+						20 * time.Millisecond,
+						40 * time.Millisecond,
+					} {
+						select {
+						case <-ctx.Done():
+							return ctx.Err()
+						case d := <-clock.Waits:
+							if d != wait {
+								return fmt.Errorf("unexpected backoff: got %s, want %s", d, wait)
+							}
+						}
+
+						if wait == 40*time.Millisecond {
+							if _, err := Receive(ctx); err != nil {
+								return err
+							}
+						}
+
+						clock.Advance(wait)
+					}
+
+					// The queue may not have space again until just after the
+					// first message is received, so keep advancing the clock
+					// until the retry succeeds.
+					go func() {
+						for {
+							select {
+							case <-ctx.Done():
+								return
+							case d := <-clock.Waits:
+								clock.Advance(d)
+							}
+						}
+					}()
+
+					m, err := ReceiveAs[int](ctx)
+					if err != nil {
+						return err
+					}
+					if m != 2 {
+						return fmt.Errorf("unexpected message: got %d, want %d", m, 2)
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := Send(ctx, 1); err != nil {
+						return err
+					}
+
+					return SendRetry(ctx, 2, 0, 10*time.Millisecond)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it returns the error from the final attempt", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		clock := newManualClock()
+		done := make(chan struct{})
+
+		err := Run(
+			ctx,
+			WithClock(clock),
+			WithMaxQueueDepth[int](1),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					for range 2 {
+						select {
+						case <-ctx.Done():
+							return ctx.Err()
+						case d := <-clock.Waits:
+							clock.Advance(d)
+						}
+					}
+
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-done:
+					}
+
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := Send(ctx, 1); err != nil {
+						return err
+					}
+
+					err := SendRetry(ctx, 2, 3, 10*time.Millisecond)
+					close(done)
+
+					if !errors.Is(err, ErrQueueFull) {
+						return fmt.Errorf("unexpected error: got %v, want %q", err, ErrQueueFull)
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it does not retry other errors", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					CloseOutbox(ctx)
+
+					if err := SendRetry(ctx, 1, 0, 10*time.Millisecond); err != ErrOutboxClosed {
+						return fmt.Errorf("unexpected error: got %v, want %q", err, ErrOutboxClosed)
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it panics if the arguments are negative", func(t *testing.T) {
+		cases := []struct {
+			attempts int
+			backoff  time.Duration
+		}{
+			{-1, 0},
+			{0, -1},
+		}
+
+		for _, c := range cases {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Fatalf("expected a panic for %d attempts with a backoff of %s", c.attempts, c.backoff)
+					}
+				}()
+
+				SendRetry(context.Background(), 1, c.attempts, c.backoff)
+			}()
+		}
+	})
+}
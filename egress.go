@@ -0,0 +1,65 @@
+package minibus
+
+import (
+	"context"
+	"sync"
+)
+
+// Egress returns a [Func] that subscribes to messages of type T and forwards
+// each message it receives to messages.
+//
+// It is the counterpart to [Ingest], allowing code outside of [Run] to consume
+// the messages sent by its functions. The function never closes messages.
+//
+// Messages can be forwarded from one call to [Run] to another by passing the
+// same channel to Egress in the first call and to [Ingest] in the second.
+//
+// The function returns the context's error when ctx is canceled.
+func Egress[T any](messages chan<- T) Func {
+	return func(ctx context.Context) error {
+		Subscribe[T](ctx)
+		Ready(ctx)
+
+		for {
+			m, err := ReceiveAs[T](ctx)
+			if err != nil {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case messages <- m:
+			}
+		}
+	}
+}
+
+// Collect returns a [Func] that subscribes to messages of type T and appends
+// each message it receives to *out.
+//
+// As with [Egress], the function returns the context's error when ctx is
+// canceled. The same function may be executed more than once, such as by
+// [Fork], in which case the messages received by every copy are appended to
+// *out. *out must not be read until [Run] has returned.
+//
+// It is intended for use in tests and short-lived batch jobs.
+func Collect[T any](out *[]T) Func {
+	var m sync.Mutex
+
+	return func(ctx context.Context) error {
+		Subscribe[T](ctx)
+		Ready(ctx)
+
+		for {
+			v, err := ReceiveAs[T](ctx)
+			if err != nil {
+				return err
+			}
+
+			m.Lock()
+			*out = append(*out, v)
+			m.Unlock()
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package minibus_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+type shout string
+
+func TestEgress(t *testing.T) {
+	t.Run("it forwards each message to the channel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		in := make(chan string, 3)
+		in <- "<one>"
+		in <- "<two>"
+		in <- "<three>"
+		close(in)
+
+		out := make(chan shout)
+		result := make(chan error, 1)
+
+		go func() {
+			result <- Run(
+				ctx,
+				WithFunc(Ingest(in)),
+				WithFunc(
+					Serve(
+						func(ctx context.Context, m string) error {
+							return Send(ctx, shout(strings.ToUpper(m)))
+						},
+					),
+				),
+				WithFunc(Egress(out)),
+			)
+		}()
+
+		for _, want := range []shout{"<ONE>", "<TWO>", "<THREE>"} {
+			select {
+			case <-ctx.Done():
+				t.Fatal(ctx.Err())
+			case got := <-out:
+				if got != want {
+					t.Fatalf("unexpected message: got %q, want %q", got, want)
+				}
+			}
+		}
+
+		cancel()
+
+		if err := <-result; err != context.Canceled {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, context.Canceled)
+		}
+	})
+
+	t.Run("it connects two sessions when paired with Ingest", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		pipe := make(chan string)
+		upstream := make(chan error, 1)
+
+		go func() {
+			upstream <- Run(
+				ctx,
+				WithFunc(Once("<message>")),
+				WithFunc(Egress(pipe)),
+			)
+		}()
+
+		var received string
+
+		err := Run(
+			ctx,
+			WithFunc(Ingest(pipe)),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					var err error
+					received, err = ReceiveAs[string](ctx)
+					cancel()
+
+					return err
+				},
+			),
+		)
+		if err != context.Canceled {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, context.Canceled)
+		}
+
+		if err := <-upstream; err != context.Canceled {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, context.Canceled)
+		}
+
+		if received != "<message>" {
+			t.Fatalf("unexpected message: got %q, want %q", received, "<message>")
+		}
+	})
+
+	t.Run("it returns the context's error when ctx is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		egress := Egress(make(chan string))
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					err := egress(ctx)
+					if err != context.Canceled {
+						t.Errorf("Egress() returned an unexpected error: got %v, want %q", err, context.Canceled)
+					}
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					cancel()
+					return nil
+				},
+			),
+		)
+		if err != context.Canceled {
+			t.Fatalf("Run() returned an unexpected error: got %v, want %q", err, context.Canceled)
+		}
+	})
+}
+
+func TestCollect(t *testing.T) {
+	t.Run("it appends each message to the slice", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		in := make(chan string, 3)
+		in <- "<one>"
+		in <- "<two>"
+		in <- "<three>"
+		close(in)
+
+		var collected []string
+
+		err := Run(
+			ctx,
+			WithFunc(Ingest(in)),
+			WithFunc(Collect(&collected)),
+		)
+
+		if err != context.DeadlineExceeded {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, context.DeadlineExceeded)
+		}
+
+		if want := []string{"<one>", "<two>", "<three>"}; !slices.Equal(collected, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", collected, want)
+		}
+	})
+
+	t.Run("it returns the context's error when ctx is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var collected []string
+		collect := Collect(&collected)
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					err := collect(ctx)
+					if err != context.Canceled {
+						t.Errorf("Collect() returned an unexpected error: got %v, want %q", err, context.Canceled)
+					}
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					cancel()
+					return nil
+				},
+			),
+		)
+		if err != context.Canceled {
+			t.Fatalf("Run() returned an unexpected error: got %v, want %q", err, context.Canceled)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package minibus
+
+import (
+	"context"
+	"reflect"
+)
+
+// Envelope is a message of type T, wrapped with metadata.
+//
+// An Envelope sent using [Send] or any of its variants is unwrapped before it's
+// delivered; it's routed as though its message was sent as type T, and the
+// recipients receive the message itself. Recipients can obtain the metadata
+// using [ReceivedMetadata].
+type Envelope[T any] struct {
+	Message  T
+	Metadata map[string]string
+}
+
+// wrapper is an interface for [Envelope] of any message type.
+type wrapper interface {
+	unwrap() envelope
+}
+
+func (e Envelope[T]) unwrap() envelope {
+	return envelope{
+		Type:     reflect.TypeFor[T](),
+		Message:  e.Message,
+		Metadata: e.Metadata,
+	}
+}
+
+// ReceivedMetadata returns the metadata of the [Envelope] that contained the
+// message most recently received by the calling function.
+//
+// It returns nil if the message was not sent in an Envelope, or if the function
+// has not received any messages. The map is shared by all recipients of the
+// message, so it must not be modified.
+//
+// It may only be called within a function that has been called by [Run].
+func ReceivedMetadata(ctx context.Context) map[string]string {
+	env, _ := caller(ctx).Received()
+	return env.Metadata
+}
@@ -0,0 +1,123 @@
+package minibus_test
+
+import (
+	"context"
+	"io"
+	"maps"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestEnvelope(t *testing.T) {
+	t.Run("it delivers the message to subscribers of its type along with the metadata", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var (
+			received []any
+			metadata []map[string]string
+		)
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					for range 2 {
+						m, err := Receive(ctx)
+						if err != nil {
+							return err
+						}
+
+						received = append(received, m)
+						metadata = append(metadata, ReceivedMetadata(ctx))
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := Send(
+						ctx,
+						Envelope[string]{
+							Message:  "<wrapped>",
+							Metadata: map[string]string{"<key>": "<value>"},
+						},
+					); err != nil {
+						return err
+					}
+
+					return Send(ctx, "<unwrapped>")
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if len(received) != 2 || received[0] != "<wrapped>" || received[1] != "<unwrapped>" {
+			t.Fatalf("unexpected messages: got %v, want [<wrapped> <unwrapped>]", received)
+		}
+
+		if want := map[string]string{"<key>": "<value>"}; !maps.Equal(metadata[0], want) {
+			t.Fatalf("unexpected metadata: got %v, want %v", metadata[0], want)
+		}
+
+		if metadata[1] != nil {
+			t.Fatalf("unexpected metadata: got %v, want nil", metadata[1])
+		}
+	})
+
+	t.Run("it routes the message as the envelope's type parameter", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received any
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[*reader](ctx)
+					Ready(ctx)
+
+					if m, err := ReceiveTimeout(ctx, 20*time.Millisecond); err != context.DeadlineExceeded {
+						t.Errorf("unexpected message: got %v, %v", m, err)
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[io.Reader](ctx)
+					Ready(ctx)
+
+					var err error
+					received, err = Receive(ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, Envelope[io.Reader]{Message: &reader{"<message>"}})
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if r, ok := received.(*reader); !ok || r.Name != "<message>" {
+			t.Fatalf("unexpected message: got %v", received)
+		}
+	})
+}
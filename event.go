@@ -0,0 +1,73 @@
+package minibus
+
+import "reflect"
+
+// Event is a notification of something that occurred within a call to [Run],
+// as sent to the channel passed to the [WithEventSink] option.
+//
+// It is one of [FuncReady], [FuncReturned], [MessageSent], [MessageDelivered]
+// or [MessageDropped].
+type Event interface {
+	isEvent()
+}
+
+// FuncReady is an [Event] that indicates that a function called [Ready].
+type FuncReady struct {
+	// Func is the name of the function.
+	Func string
+}
+
+// FuncReturned is an [Event] that indicates that a function returned.
+type FuncReturned struct {
+	// Func is the name of the function.
+	Func string
+
+	// Err is the error that the function returned, if any.
+	Err error
+}
+
+// MessageSent is an [Event] that indicates that a message was sent, before
+// it's routed to its recipients.
+type MessageSent struct {
+	// Type is the type used to route the message, which is usually the
+	// message's dynamic type.
+	Type reflect.Type
+}
+
+// MessageDelivered is an [Event] that indicates that a message was placed in a
+// recipient's inbox.
+type MessageDelivered struct {
+	// Type is the type used to route the message.
+	Type reflect.Type
+
+	// To is the name of the recipient.
+	To string
+}
+
+// MessageDropped is an [Event] that indicates that a message has no
+// recipients, was dropped by inbound middleware or under the [DropWhenFull]
+// policy, or was not delivered to a recipient because the recipient returned
+// or the session shut down first.
+type MessageDropped struct {
+	// Type is the type used to route the message.
+	Type reflect.Type
+}
+
+func (FuncReady) isEvent()        {}
+func (FuncReturned) isEvent()     {}
+func (MessageSent) isEvent()      {}
+func (MessageDelivered) isEvent() {}
+func (MessageDropped) isEvent()   {}
+
+// emit sends e to the event sink, if any. It never blocks; the event is
+// discarded if the sink is not ready to receive it.
+func (f *function) emit(e Event) {
+	if f.Config.Events == nil {
+		return
+	}
+
+	select {
+	case f.Config.Events <- e:
+	default:
+	}
+}
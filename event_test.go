@@ -0,0 +1,132 @@
+package minibus_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestWithEventSink(t *testing.T) {
+	t.Run("it sends events for the functions and messages in the session", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		events := make(chan Event, 100)
+		delivered := make(chan struct{})
+
+		err := Run(
+			ctx,
+			WithEventSink(events),
+			WithNamedFunc(
+				"<sender>",
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := SendSync(ctx, "<message>"); err != nil {
+						return err
+					}
+
+					close(delivered)
+					return nil
+				},
+			),
+			WithNamedFunc(
+				"<receiver>",
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+
+					<-delivered
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		var got []Event
+		for len(events) > 0 {
+			got = append(got, <-events)
+		}
+
+		if len(got) != 6 {
+			t.Fatalf("unexpected number of events: got %d, want 6: %v", len(got), got)
+		}
+
+		// The functions become ready, and return, concurrently, so the order
+		// of those events is not deterministic.
+		byString := func(a, b Event) int {
+			return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+		}
+		slices.SortFunc(got[0:2], byString)
+		slices.SortFunc(got[4:6], byString)
+
+		stringType := reflect.TypeFor[string]()
+		want := []Event{
+			FuncReady{Func: "<receiver>"},
+			FuncReady{Func: "<sender>"},
+			MessageSent{Type: stringType},
+			MessageDelivered{Type: stringType, To: "<receiver>"},
+			FuncReturned{Func: "<receiver>"},
+			FuncReturned{Func: "<sender>"},
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("unexpected events: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("it sends an event for each recipient of a message with several recipients", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		events := make(chan Event, 100)
+
+		err := Run(
+			ctx,
+			WithEventSink(events),
+			WithInboxBuffer(1),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, "<message>")
+				},
+			),
+			Fork(
+				3,
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		delivered := 0
+		for len(events) > 0 {
+			if _, ok := (<-events).(MessageDelivered); ok {
+				delivered++
+			}
+		}
+
+		if delivered != 3 {
+			t.Fatalf("unexpected number of MessageDelivered events: got %d, want 3", delivered)
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/dogmatiq/minibus"
+	"golang.org/x/sync/errgroup"
 )
 
 func Example() {
@@ -56,8 +57,8 @@ func Example() {
 	// exchanges messages between them. It blocks until all functions return.
 	if err := minibus.Run(
 		ctx,
-		recipient,
-		sender,
+		minibus.WithFunc(recipient),
+		minibus.WithFunc(sender),
 	); err != nil {
 		fmt.Println(err)
 	}
@@ -94,8 +95,8 @@ func ExampleSubscribe_fireHose() {
 
 	if err := minibus.Run(
 		ctx,
-		recipient,
-		sender,
+		minibus.WithFunc(recipient),
+		minibus.WithFunc(sender),
 	); err != context.DeadlineExceeded {
 		fmt.Println(err)
 	}
@@ -104,3 +105,63 @@ func ExampleSubscribe_fireHose() {
 	// Hello, world!
 	// 42
 }
+
+func ExampleRun_errgroup() {
+	// Run composes naturally with [errgroup.Group]. The session is just
+	// another goroutine in the group. If any goroutine in the group fails the
+	// group's context is canceled, which stops the session. Likewise, if any
+	// function in the session fails Run returns its error, which cancels the
+	// rest of the group.
+	g, ctx := errgroup.WithContext(context.Background())
+
+	results := make(chan string)
+
+	g.Go(func() error {
+		return minibus.Run(
+			ctx,
+			minibus.WithFunc(
+				func(ctx context.Context) error {
+					minibus.Subscribe[string](ctx)
+					minibus.Ready(ctx)
+
+					m, err := minibus.Receive(ctx)
+					if err != nil {
+						return err
+					}
+
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case results <- m.(string):
+						return nil
+					}
+				},
+			),
+			minibus.WithFunc(
+				func(ctx context.Context) error {
+					minibus.Ready(ctx)
+					return minibus.Send(ctx, "Hello, world!")
+				},
+			),
+		)
+	})
+
+	// This goroutine is not part of the session, but it consumes the results
+	// that the session produces.
+	g.Go(func() error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m := <-results:
+			fmt.Println(m)
+			return nil
+		}
+	})
+
+	if err := g.Wait(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// Hello, world!
+}
@@ -0,0 +1,80 @@
+package minibus
+
+import (
+	"context"
+	"slices"
+)
+
+// Execution is a call to [Run] that is executing in the background, as started
+// by [RunAsync].
+type Execution struct {
+	ready chan struct{}
+	done  chan struct{}
+	err   error
+}
+
+// RunAsync is a variant of [Run] that executes the functions in the
+// background, and returns immediately.
+//
+// Use [Execution.Wait] to wait for the functions to return and obtain the
+// result of [Run]. Messages can be streamed to code outside of the session
+// while it's running by adding an [Egress] function.
+//
+// Use [Execution.WaitReady] to wait until the functions are exchanging
+// messages, such as before sending messages into the session from outside.
+func RunAsync(ctx context.Context, options ...Option) *Execution {
+	e := &Execution{
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	options = append(
+		slices.Clip(options),
+		func(cfg *config) {
+			cfg.Ready = func() { close(e.ready) }
+		},
+	)
+
+	go func() {
+		defer close(e.done)
+		e.err = Run(ctx, options...)
+	}()
+
+	return e
+}
+
+// WaitReady blocks until all functions have called [Ready] and the functions
+// have started exchanging messages.
+//
+// It returns the error returned by [Run] if it returns before the functions
+// are ready, such as when a function fails during startup, or ctx.Err() if ctx
+// is canceled first.
+func (e *Execution) WaitReady(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-e.ready:
+		return nil
+	case <-e.done:
+	}
+
+	// Prefer the ready signal if both channels are closed.
+	select {
+	case <-e.ready:
+		return nil
+	default:
+	}
+
+	return e.err
+}
+
+// Done returns a channel that is closed when [Run] has returned.
+func (e *Execution) Done() <-chan struct{} {
+	return e.done
+}
+
+// Wait blocks until [Run] has returned, and returns its error.
+func (e *Execution) Wait() error {
+	<-e.done
+	return e.err
+}
@@ -0,0 +1,155 @@
+package minibus_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestRunAsync(t *testing.T) {
+	t.Run("it streams messages while the functions are running", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		messages := make(chan string)
+		done := make(chan struct{})
+
+		e := RunAsync(
+			ctx,
+			WithFunc(Egress(messages)),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for _, m := range []string{"<one>", "<two>"} {
+						if err := Send(ctx, m); err != nil {
+							return err
+						}
+					}
+
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-done:
+						return errors.New("<error>")
+					}
+				},
+			),
+		)
+
+		for _, want := range []string{"<one>", "<two>"} {
+			select {
+			case <-ctx.Done():
+				t.Fatal(ctx.Err())
+			case got := <-messages:
+				if got != want {
+					t.Fatalf("unexpected message: got %q, want %q", got, want)
+				}
+			}
+		}
+
+		select {
+		case <-e.Done():
+			t.Fatal("expected the execution to be running")
+		default:
+		}
+
+		close(done)
+
+		if err := e.Wait(); err == nil || err.Error() != "<error>" {
+			t.Fatalf("unexpected error: got %v, want %q", err, "<error>")
+		}
+
+		select {
+		case <-e.Done():
+		default:
+			t.Fatal("expected the execution to be done")
+		}
+	})
+	t.Run("it can wait for the functions to become ready", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		release := make(chan struct{})
+		var ready atomic.Bool
+
+		e := RunAsync(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					<-release
+					ready.Store(true)
+					Ready(ctx)
+					return nil
+				},
+			),
+		)
+
+		time.AfterFunc(10*time.Millisecond, func() { close(release) })
+
+		if err := e.WaitReady(ctx); err != nil {
+			t.Fatalf("WaitReady() returned an unexpected error: %s", err)
+		}
+
+		if !ready.Load() {
+			t.Fatal("expected the function to be ready")
+		}
+
+		if err := e.Wait(); err != nil {
+			t.Fatalf("Wait() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it returns the error from Run if it returns before the functions are ready", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		e := RunAsync(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					return errors.New("<error>")
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			),
+		)
+
+		if err := e.WaitReady(ctx); err == nil || err.Error() != "<error>" {
+			t.Fatalf("unexpected error: got %v, want %q", err, "<error>")
+		}
+	})
+
+	t.Run("it returns an error if the context passed to WaitReady is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		e := RunAsync(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			),
+		)
+
+		waitCtx, cancelWait := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancelWait()
+
+		if err := e.WaitReady(waitCtx); err != context.DeadlineExceeded {
+			t.Fatalf("unexpected error: got %v, want %q", err, context.DeadlineExceeded)
+		}
+
+		cancel()
+		e.Wait()
+	})
+}
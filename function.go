@@ -2,36 +2,259 @@ package minibus
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"reflect"
+	rtrace "runtime/trace"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // A function represents an application-defined function that exchanges messages
 // with other such functions.
 type function struct {
+	// Index is the position of the function within the list of functions
+	// executed by [Run].
+	Index int
+
+	// Name is a human-readable name for the function, used in log and trace
+	// output.
+	Name string
+
+	// Config is the configuration of the call to [Run] that executes the
+	// function, which is shared by all of its functions.
+	Config *config
+
+	// DeliverySlots, if non-nil, is a semaphore that limits the number of
+	// recipients to which the function's messages are delivered concurrently.
+	DeliverySlots chan struct{}
+
+	// Workers, if non-nil, is the channel on which deliveries of the
+	// function's messages are passed to the pool of delivery goroutines.
+	Workers chan<- delivery
+
+	// Deadlock, if non-nil, is used to detect when all functions are blocked
+	// receiving messages. SessionDone is the Done channel of the session's
+	// context, which is used to determine whether a call to [Receive] may
+	// block indefinitely.
+	Deadlock    *deadlockDetector
+	SessionDone <-chan struct{}
+
+	// Live is the number of functions in the session that have been started
+	// but are yet to return.
+	Live *atomic.Int64
+
 	// Func is the application-defined function to execute.
 	Func Func
 
+	// SelfDelivery is true if the function receives the messages that it
+	// sends, if it subscribes to them.
+	SelfDelivery bool
+
+	// Group is the name of the group that the function belongs to, if any, as
+	// per [WithGroup]. Selected is the number of messages for which it has
+	// been selected as the group's recipient, as per [WithFairDelivery].
+	Group    string
+	Selected atomic.Int64
+
+	// Owner, if non-nil, is the function on whose behalf this function
+	// receives messages, as used by [SendAwait]. It never receives the
+	// messages that its owner sends.
+	Owner *function
+
+	// Interceptor, if non-nil, transforms or drops each message before it's
+	// placed in the function's inbox, as per [WithInboxInterceptor].
+	Interceptor func(context.Context, any) (any, bool)
+
 	// Inbox and Outbox are the channels on which the function receives and
 	// sends messages, respectively. Both channels block until all functions
 	// have signalled readiness.
-	Inbox, Outbox chan any
+	Inbox  chan envelope
+	Outbox chan any
+
+	// Background is used to track goroutines that are started on behalf of
+	// the function, so that [Run] can wait for them to exit.
+	Background *sync.WaitGroup
+
+	// messages is the channel returned by [Inbox]. It is created on demand,
+	// and fed from Inbox by a goroutine that unwraps each envelope. Once that
+	// goroutine is running, [Receive] and friends read from envelopes instead
+	// of Inbox, so that the goroutine never holds a message they can't reach.
+	//
+	// The goroutine records a message as received only once it has been read
+	// from messages. Received() sends to settle to wait for it to do so, or
+	// for relayDone to be closed when the goroutine exits. The channels are
+	// protected by m.
+	messages     chan any
+	envelopes    chan envelope
+	settle       chan struct{}
+	relayDone    chan struct{}
+	messagesOnce sync.Once
+
+	// channels are the typed channels returned by [Channel], which are fed
+	// from Inbox by a single goroutine that routes each message to the first
+	// channel that accepts it. channelsClosed is true once that goroutine has
+	// exited. Both are protected by m.
+	channels       []typedChannel
+	channelsClosed bool
+
+	// received is the envelope of the message that was most recently
+	// received by the function, if any.
+	m           sync.Mutex
+	received    envelope
+	hasReceived bool
+
+	// publications is the set of types that the function has declared that it
+	// sends, using [Publish]. It is protected by m.
+	publications map[reflect.Type]struct{}
+
+	// requests is the set of channels on which replies to pending requests
+	// are delivered, keyed by correlation ID.
+	requests      map[uint64]chan envelope
+	lastRequestID uint64
 
 	// Subscriptions is the set of subscriptions for all "peers" of this
 	// function. That is, the functions that may exchange messages with this
 	// one.
 	Subscriptions *subscriptions
 
-	// Returned is a channel that is signaled when the function is ready to
+	// ReadySignal is a channel that is sent the function when it's ready to
 	// exchange messages. It is set to nil when the function calls [Ready].
-	ReadySignal chan<- struct{}
+	ReadySignal chan<- *function
+
+	// ReadyLatch is a channel that is closed when all of the functions
+	// executed by [Run] have called [Ready].
+	ReadyLatch <-chan struct{}
 
 	// ReturnSignal is a channel that is signalled when the function has
 	// returned.
 	ReturnSignal chan<- functionResult
 
+	// FailSignal is a channel on which the function's message pump reports
+	// errors that must cause [Run] to shut down.
+	FailSignal chan<- error
+
+	// SpawnSignal is a channel on which the function requests that [Run]
+	// start an additional function.
+	SpawnSignal chan<- funcConfig
+
 	// ReturnLatch is a channel that is closed when the function returns.
 	ReturnLatch chan struct{}
+
+	// StopLatch is a channel that is closed when the function calls [Stop].
+	// Once it's closed the function's inbox behaves as though it's closed.
+	StopLatch chan struct{}
+	stopOnce  sync.Once
+
+	// OutboxLatch is a channel that is closed when the function calls
+	// [CloseOutbox].
+	OutboxLatch     chan struct{}
+	closeOutboxOnce sync.Once
+
+	// PumpLatch is a channel that is closed when the function's message pump
+	// stops.
+	PumpLatch chan struct{}
+}
+
+// envelope is a message in transit, along with the information needed to
+// route it to its subscribers.
+type envelope struct {
+	// Type is the type used to find the message's subscribers. It is usually
+	// the message's dynamic type, but it may be an interface type if the
+	// message was sent using [SendAs].
+	Type reflect.Type
+
+	// Message is the message itself.
+	Message any
+
+	// Sender is the function that sent the message.
+	Sender *function
+
+	// Recipient is the only function that may receive the message, if it was
+	// sent using [SendTo] or [Reply]. If it is nil the message is delivered to
+	// all subscribers.
+	Recipient *function
+
+	// CorrelationID identifies the request that the message belongs to. It is
+	// non-zero for requests sent using [Request], and for their replies.
+	CorrelationID uint64
+
+	// SpanContext is the OpenTelemetry span context of the message's most
+	// recent publish or delivery span, if tracing is enabled.
+	SpanContext trace.SpanContext
+
+	// Metadata is the metadata of the [Envelope] that the message was sent in,
+	// if any.
+	Metadata map[string]string
+
+	// Depth, if non-nil, is the number of undelivered messages of the same
+	// type, as per [WithMaxQueueDepth]. It counts the message once until it's
+	// routed, and then once for each recipient that is yet to receive it.
+	Depth *queueDepth
+
+	// SentAt is the time at which the message was sent. It's only set if
+	// statistics are being collected, as per [WithStats].
+	SentAt time.Time
+
+	// Values are the values from the sender's context that are propagated to
+	// the recipients, as per the [WithContextValues] option.
+	Values []contextValue
+
+	// Done, if non-nil, is sent a value once the message has been delivered
+	// to all of its recipients. The value is false if delivery was interrupted
+	// because [Run] is shutting down. It must have a buffer of at least one.
+	Done chan<- bool
+
+	// Ack, if non-nil, is closed once the message has been delivered to all of
+	// its recipients. It's not closed if delivery was interrupted because
+	// [Run] is shutting down.
+	Ack chan struct{}
+
+	// IsReply is true if the message is a reply sent using [Reply]. Replies
+	// bypass the recipient's subscriptions and inbox, and are passed directly
+	// to the pending [Request] call.
+	IsReply bool
+
+	// IsRetained is true if the message was sent using [SendRetained], and so
+	// is replayed to functions that subscribe to it later.
+	IsRetained bool
+
+	// ShardKey is the key used to select a member of each group, if the
+	// message was sent using [SendSharded], in which case IsSharded is true.
+	ShardKey  string
+	IsSharded bool
+}
+
+// anyType is the [reflect.Type] of the empty interface.
+var anyType = reflect.TypeFor[any]()
+
+// envelopeOf returns the envelope for a value that was read from an outbox.
+//
+// Messages sent by [Send] or directly to the outbox are routed by their dynamic
+// type. A nil message has no dynamic type, so it's routed as [any]. An
+// [Envelope] is unwrapped, and routed by its message type.
+func envelopeOf(v any) envelope {
+	if env, ok := v.(envelope); ok {
+		return env
+	}
+
+	if w, ok := v.(wrapper); ok {
+		return w.unwrap()
+	}
+
+	t := reflect.TypeOf(v)
+	if t == nil {
+		t = anyType
+	}
+
+	return envelope{
+		Type:    t,
+		Message: v,
+	}
 }
 
 type functionResult struct {
@@ -52,49 +275,739 @@ func caller(ctx context.Context) *function {
 
 // Call invokes the function and signals when it has returned.
 func (f *function) Call(ctx context.Context) {
+	for _, fn := range f.Config.Context {
+		ctx = fn(ctx)
+	}
+
 	ctx = context.WithValue(ctx, callerKey{}, f)
 
-	err := f.Func(ctx)
+	ctx, task := rtrace.NewTask(ctx, f.Name)
+	defer task.End()
+
+	f.log(ctx, "started")
+	f.Config.Stats.FuncStarted(f.Name)
+
+	err := f.call(ctx)
+
+	// A function that is isolated after panicking must not receive any more
+	// messages, so its subscriptions are removed before any other function can
+	// observe that it has returned.
+	p, isolated := err.(*PanicError)
+	isolated = isolated && f.Config.PanicPolicy == IsolateFunction
+	if isolated {
+		f.Subscriptions.Remove(f)
+	}
+
+	f.Live.Add(-1)
+	f.Config.Stats.FuncReturned(f.Name, err)
+
+	if err != nil {
+		f.log(ctx, "returned", slog.Any("error", err))
+	} else {
+		f.log(ctx, "returned")
+	}
+
+	if isolated {
+		f.log(ctx, "isolated", slog.Any("panic", p.Value()))
+		err = nil
+	}
+
+	f.emit(FuncReturned{f.Name, err})
 
 	close(f.ReturnLatch)
+	f.discardInbox()
 	f.ReturnSignal <- functionResult{f, err}
 }
 
-func (f *function) Pump(ctx context.Context) {
+// call invokes the function, converting any panic into a [PanicError].
+func (f *function) call(ctx context.Context) (err error) {
+	defer recoverPanic(&err)
+	return f.Func(ctx)
+}
+
+// Subscribe subscribes the function to messages of type t. If flt is non-nil,
+// only those messages that it accepts are delivered.
+func (f *function) Subscribe(ctx context.Context, t reflect.Type, flt filter) {
+	f.Subscriptions.Add(f, t, flt)
+	f.verbose(ctx, "subscribed", slog.String("message_type", t.String()))
+}
+
+// Unsubscribe removes the function's subscription to messages of type t.
+func (f *function) Unsubscribe(ctx context.Context, t reflect.Type) {
+	f.Subscriptions.RemoveType(f, t)
+	f.verbose(ctx, "unsubscribed", slog.String("message_type", t.String()))
+}
+
+// Publish declares that the function sends messages of type t.
+func (f *function) Publish(ctx context.Context, t reflect.Type) {
+	f.m.Lock()
+	if f.publications == nil {
+		f.publications = map[reflect.Type]struct{}{}
+	}
+	f.publications[t] = struct{}{}
+	f.m.Unlock()
+
+	f.verbose(ctx, "publishes", slog.String("message_type", t.String()))
+}
+
+// IsPublished returns true if the function has declared that it sends messages
+// of type t, either directly or by declaring an interface that t implements.
+func (f *function) IsPublished(t reflect.Type) bool {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if _, ok := f.publications[t]; ok {
+		return true
+	}
+
+	for p := range f.publications {
+		if p.Kind() == reflect.Interface && t.Implements(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Pump delivers messages from the function's outbox to the inboxes of the
+// functions that subscribe to them.
+//
+// It stops reading from the outbox when ctx is canceled, but a delivery that
+// is already in progress continues until deliveryCtx is canceled. If the
+// session has a drain timeout, messages that are still buffered in the outbox
+// are also delivered using deliveryCtx.
+//
+// Each message is delivered to all of its recipients before the next message
+// is read from the outbox, which guarantees that each recipient receives the
+// function's messages in the order they were sent.
+func (f *function) Pump(ctx, deliveryCtx context.Context) {
+	defer close(f.PumpLatch)
+
 	for {
 		select {
 		case <-ctx.Done():
+			if f.Config.DrainTimeout > 0 {
+				f.drainOutbox(deliveryCtx)
+			}
 			return
 		case m := <-f.Outbox:
-			f.deliver(ctx, m)
+			f.forward(deliveryCtx, m)
 		case <-f.ReturnLatch:
+			f.drainOutbox(deliveryCtx)
+			return
+		case <-f.OutboxLatch:
+			f.drainOutbox(deliveryCtx)
+			return
 		}
 	}
 }
 
-func (f *function) deliver(ctx context.Context, m any) {
-	t := reflect.TypeOf(m)
-	subs := f.Subscriptions.Subscribers(t)
+// forward delivers a message that was read from the function's outbox, and
+// notifies the sender of the outcome if it's waiting.
+func (f *function) forward(ctx context.Context, m any) {
+	env := envelopeOf(m)
+	ok := f.deliver(ctx, env)
+	f.Deadlock.Add(-1)
+	env.Depth.Add(-1)
 
-	var g sync.WaitGroup
+	if env.Done != nil {
+		env.Done <- ok
+	}
 
-	for sub := range subs {
-		if sub == f {
-			continue
+	if env.Ack != nil && ok {
+		close(env.Ack)
+	}
+}
+
+// drainOutbox delivers any messages that are still buffered in the function's
+// outbox, as per [WithOutboxBuffer].
+func (f *function) drainOutbox(ctx context.Context) {
+	for {
+		select {
+		case m := <-f.Outbox:
+			f.forward(ctx, m)
+		default:
+			return
 		}
+	}
+}
 
-		g.Add(1)
+// Stop stops the function from receiving any further messages.
+func (f *function) Stop(ctx context.Context) {
+	f.stopOnce.Do(func() {
+		f.Subscriptions.Remove(f)
+		close(f.StopLatch)
+		f.discardInbox()
+		f.log(ctx, "stopped")
+	})
+}
 
-		go func() {
-			defer g.Done()
+// CloseOutbox stops the function from sending any further messages.
+func (f *function) CloseOutbox() {
+	f.closeOutboxOnce.Do(func() {
+		close(f.OutboxLatch)
+	})
+}
+
+// deliver delivers env to each of its recipients, blocking until they have all
+// accepted it. It returns false if ctx is canceled before the message is
+// delivered to every recipient that is still running.
+func (f *function) deliver(ctx context.Context, env envelope) bool {
+	env.Sender = f
+
+	if f.isCollected() {
+		env = stamp(env)
+	}
+
+	if len(f.Config.Outbound) != 0 {
+		var err error
+		if env, err = f.applyOutbound(ctx, env); err != nil {
+			f.fail(ctx, err)
+			return false
+		}
+	}
+
+	if f.Config.AllowedTypes != nil {
+		if _, ok := f.Config.AllowedTypes[env.Type]; !ok {
+			f.fail(ctx, fmt.Errorf("%w: %s, sent by %q", ErrTypeNotAllowed, env.Type, f.Name))
+			return false
+		}
+	}
+
+	f.Config.Stats.MessageSent(f.Name, env.Type)
+	f.emit(MessageSent{env.Type})
+
+	if env.IsReply {
+		env.Recipient.acceptReply(env)
+		return true
+	}
+
+	return f.route(ctx, env)
+}
+
+// route delivers env, which was sent by f, to each of the functions that
+// subscribe to it. It returns false if any of the deliveries were interrupted
+// by ctx being canceled.
+func (f *function) route(ctx context.Context, env envelope) bool {
+	// Messages of a type that is totally ordered are delivered one at a time,
+	// as per [WithTotalOrder].
+	if m, ok := f.Config.TotalOrder[env.Type]; ok {
+		m.Lock()
+		defer m.Unlock()
+	}
+
+	// Collect the recipients up front, so that each subscriber's filter is
+	// evaluated exactly once. The array keeps the common case of a small
+	// number of recipients off the heap.
+	var buf [8]*function
+	recipients := buf[:0]
+
+	var subs map[*function]filter
+	if env.IsRetained {
+		subs = f.Subscriptions.Retain(env)
+	} else {
+		subs = f.Subscriptions.Subscribers(env.Type)
+	}
+
+	for sub, flt := range subs {
+		if env.isRecipient(sub, flt) {
+			recipients = append(recipients, sub)
+		}
+	}
+
+	if env.Recipient == nil {
+		recipients = selectGroupMembers(env, recipients, f.Config.FairDelivery)
+
+		if f.Config.Routing != nil && len(recipients) != 0 {
+			recipients = selectRecipients(f.Config.Routing, env, recipients)
+		}
+	}
+
+	if len(recipients) == 0 {
+		return f.deadLetter(ctx, env)
+	}
+
+	if len(f.Config.Inbound) != 0 {
+		var (
+			ok  bool
+			err error
+		)
+
+		if env, ok, err = f.applyInbound(ctx, env); err != nil {
+			f.fail(ctx, err)
+			return false
+		} else if !ok {
+			f.Config.Stats.MessageDropped(f.Name, env.Type)
+			f.emit(MessageDropped{env.Type})
+			return true
+		}
+	}
+
+	// Each delivery is pending from before the message is placed in the
+	// recipient's inbox until the recipient receives it, or it's dropped.
+	f.Deadlock.Add(len(recipients))
+	env.Depth.Add(len(recipients))
+
+	switch {
+	case len(recipients) == 1:
+		// Deliver directly to the only recipient. This is a very common case,
+		// and it avoids the overhead of starting a goroutine.
+		return recipients[0].accept(ctx, env)
+	case f.Config.Deterministic || f.Config.Inline:
+		return f.deliverInline(ctx, recipients, env)
+	default:
+		return f.fanOut(ctx, recipients, env)
+	}
+}
+
+// selectRecipients returns the subset of the recipients of env that are
+// selected by the routing function, as per [WithRouting].
+func selectRecipients(
+	routing func(any, []string) []string,
+	env envelope,
+	recipients []*function,
+) []*function {
+	slices.SortFunc(
+		recipients,
+		func(a, b *function) int {
+			return a.Index - b.Index
+		},
+	)
+
+	names := make([]string, len(recipients))
+	for i, sub := range recipients {
+		names[i] = sub.Name
+	}
 
+	selected := routing(env.Message, names)
+
+	return slices.DeleteFunc(
+		recipients,
+		func(sub *function) bool {
+			return !slices.Contains(selected, sub.Name)
+		},
+	)
+}
+
+// deliverInline delivers env, which was sent by f, to each of the recipients
+// in turn. It returns false if any of the deliveries were interrupted by ctx
+// being canceled.
+//
+// If f uses deterministic ordering, the recipients are sorted in the order
+// that the functions were added to [Run].
+func (f *function) deliverInline(ctx context.Context, recipients []*function, env envelope) bool {
+	if f.Config.Deterministic {
+		slices.SortFunc(
+			recipients,
+			func(a, b *function) int {
+				return a.Index - b.Index
+			},
+		)
+	}
+
+	ok := true
+
+	for _, sub := range recipients {
+		if !sub.accept(ctx, env) {
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// fanOut delivers env, which was sent by f, to each of the recipients
+// concurrently. It returns false if any of the deliveries were interrupted by
+// ctx being canceled.
+func (f *function) fanOut(ctx context.Context, recipients []*function, env envelope) bool {
+	// The state shared with the delivery goroutines is only allocated if at
+	// least one goroutine is needed.
+	var state *fanOutState
+
+	for _, sub := range recipients {
+		// Try to deliver the message without starting a goroutine first. This
+		// succeeds when the inbox is buffered and has space, or the recipient
+		// is already waiting to receive. It's skipped when tracing, as each
+		// delivery needs its own span, and when the recipient intercepts its
+		// messages.
+		if sub.Config.Tracer == nil && sub.Interceptor == nil {
+			select {
+			case sub.Inbox <- env:
+				sub.delivered(env)
+				continue
+			default:
+			}
+		}
+
+		if state == nil {
+			state = &fanOutState{Envelope: env}
+		}
+
+		// Once ctx is canceled, the remaining deliveries are dropped up front,
+		// rather than starting a goroutine for each of them that would only
+		// drop the message itself.
+		select {
+		case <-ctx.Done():
+			sub.drop(env)
+			state.Interrupted.Store(true)
+			continue
+		default:
+		}
+
+		if f.DeliverySlots != nil {
 			select {
 			case <-ctx.Done():
-			case <-sub.ReturnLatch:
-			case sub.Inbox <- m:
+				sub.drop(env)
+				state.Interrupted.Store(true)
+				continue
+			case f.DeliverySlots <- struct{}{}:
+			}
+		}
+
+		state.Add(1)
+
+		d := delivery{
+			Context:   ctx,
+			Recipient: sub,
+			State:     state,
+			Slots:     f.DeliverySlots,
+		}
+
+		// Pass the delivery to an idle worker, if there is one. Otherwise,
+		// start a new goroutine.
+		select {
+		case f.Workers <- d:
+		default:
+			go d.Run()
+		}
+	}
+
+	if state == nil {
+		return true
+	}
+
+	state.Wait()
+
+	return !state.Interrupted.Load()
+}
+
+// fanOutState is the state shared by the deliveries started by
+// [function.fanOut].
+type fanOutState struct {
+	sync.WaitGroup
+	Envelope    envelope
+	Interrupted atomic.Bool
+}
+
+// delivery is the delivery of a message to a single recipient, as started by
+// [function.fanOut].
+type delivery struct {
+	Context   context.Context
+	Recipient *function
+	State     *fanOutState
+	Slots     chan struct{}
+}
+
+// Run delivers the message, and signals when it's done.
+func (d delivery) Run() {
+	defer d.State.Done()
+
+	if d.Slots != nil {
+		defer func() { <-d.Slots }()
+	}
+
+	if !d.Recipient.accept(d.Context, d.State.Envelope) {
+		d.State.Interrupted.Store(true)
+	}
+}
+
+// isRecipient returns true if the message should be delivered to the given
+// subscriber, which has the given filter.
+func (e envelope) isRecipient(sub *function, flt filter) bool {
+	if sub == e.Sender && !sub.SelfDelivery {
+		return false
+	}
+
+	if sub.Owner != nil && sub.Owner == e.Sender {
+		return false
+	}
+
+	if e.Recipient != nil && e.Recipient != sub {
+		return false
+	}
+
+	return flt == nil || flt(e.Message)
+}
+
+// accept blocks until env is placed in the function's inbox, the function
+// returns, or ctx is canceled. It returns false if ctx is canceled first.
+func (f *function) accept(ctx context.Context, env envelope) bool {
+	if f.Interceptor != nil {
+		m, ok := f.Interceptor(ctx, env.Message)
+		if !ok {
+			f.drop(env)
+			return true
+		}
+		env.Message = m
+	}
+
+	if f.Config.Tracer != nil {
+		var span trace.Span
+		env, span = f.startDeliverSpan(ctx, env)
+		defer span.End()
+	}
+
+	// slow is only non-nil while the delivery has not yet been reported as
+	// being slow.
+	var slow <-chan time.Time
+	if f.Config.SlowSubscriber != nil {
+		timer := time.NewTimer(f.Config.SlowThreshold)
+		defer timer.Stop()
+		slow = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			f.drop(env)
+			return false
+		case <-f.ReturnLatch:
+			f.drop(env)
+			return true
+		case <-f.StopLatch:
+			f.drop(env)
+			return true
+		case f.Inbox <- env:
+			f.delivered(env)
+			return true
+		case <-slow:
+			slow = nil
+			f.Config.SlowSubscriber(ctx, f.Name, env.Type)
+		}
+	}
+}
+
+// Replay delivers the retained messages that the function missed because it
+// subscribed after they were sent, as per [SendRetained].
+func (f *function) Replay(ctx context.Context) {
+	for _, env := range f.Subscriptions.Replays(f) {
+		if len(f.Config.Inbound) != 0 {
+			in, ok, err := f.applyInbound(ctx, env)
+			if err != nil {
+				f.drop(env)
+				f.fail(ctx, err)
+				continue
+			} else if !ok {
+				f.drop(env)
+				continue
+			}
+			env = in
+		}
+
+		f.accept(ctx, env)
+	}
+}
+
+// drop records that env was not delivered to the function.
+func (f *function) drop(env envelope) {
+	f.Config.Stats.MessageDropped(f.Name, env.Type)
+	f.emit(MessageDropped{env.Type})
+	f.Deadlock.Add(-1)
+	env.Depth.Add(-1)
+}
+
+// isFinished returns true if the function has returned or stopped, such that
+// it will not receive any more messages.
+func (f *function) isFinished() bool {
+	select {
+	case <-f.ReturnLatch:
+		return true
+	case <-f.StopLatch:
+		return true
+	default:
+		return false
+	}
+}
+
+// discardInbox drops any messages that are waiting in the function's inbox,
+// once it has returned or stopped, so that they are no longer counted as
+// pending.
+func (f *function) discardInbox() {
+	for {
+		select {
+		case env, ok := <-f.Inbox:
+			if !ok {
+				return
+			}
+			f.drop(env)
+		default:
+			return
+		}
+	}
+}
+
+// Receive records env as the most recently received envelope and returns its
+// message.
+func (f *function) Receive(env envelope) any {
+	f.Deadlock.Add(-1)
+	env.Depth.Add(-1)
+	f.Config.Stats.MessageReceived(f.Name, env.Type)
+
+	f.m.Lock()
+	f.received = env
+	f.hasReceived = true
+	f.m.Unlock()
+
+	return env.Message
+}
+
+// Handle calls h with m, which is the message most recently received by the
+// function, and reports the time spent handling it.
+func (f *function) Handle(ctx context.Context, m any, h handlerFunc) error {
+	env, _ := f.Received()
+	start := time.Now()
+
+	err := h(ctx, m)
+	f.Config.Stats.MessageHandled(f.Name, env.Type, time.Since(start))
+
+	return err
+}
+
+// Received returns the envelope of the most recently received message.
+func (f *function) Received() (envelope, bool) {
+	f.m.Lock()
+	settle, done := f.settle, f.relayDone
+	f.m.Unlock()
+
+	if settle != nil {
+		// Wait for the goroutine that feeds [Inbox] to record any message that
+		// has already been read from it.
+		select {
+		case settle <- struct{}{}:
+		case <-done:
+		}
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	return f.received, f.hasReceived
+}
+
+// inbox returns the channel from which the function reads its envelopes when
+// receiving messages by means other than [Inbox].
+func (f *function) inbox() <-chan envelope {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.envelopes != nil {
+		return f.envelopes
+	}
+
+	return f.Inbox
+}
+
+// Messages returns a channel that receives the messages from the function's
+// inbox, without their envelopes.
+func (f *function) Messages() <-chan any {
+	f.messagesOnce.Do(func() {
+		f.m.Lock()
+		f.messages = make(chan any)
+		f.envelopes = make(chan envelope)
+		f.settle = make(chan struct{})
+		f.relayDone = make(chan struct{})
+		f.m.Unlock()
+
+		f.Background.Add(1)
+
+		go func() {
+			defer f.Background.Done()
+			defer close(f.relayDone)
+			defer close(f.envelopes)
+			defer close(f.messages)
+
+			for {
+				select {
+				case <-f.ReturnLatch:
+					return
+				case <-f.StopLatch:
+					return
+				case <-f.settle:
+				case env, ok := <-f.Inbox:
+					if !ok || !f.relay(env) {
+						return
+					}
+				}
 			}
 		}()
+	})
+
+	return f.messages
+}
+
+// relay passes env to whichever reader takes it first, either as a message
+// via [Inbox] or as an envelope via [Receive] and friends. It returns false if
+// the function stops or returns first.
+func (f *function) relay(env envelope) bool {
+	for {
+		select {
+		case <-f.ReturnLatch:
+			f.drop(env)
+			return false
+		case <-f.StopLatch:
+			f.drop(env)
+			return false
+		case <-f.settle:
+		case f.envelopes <- env:
+			return true
+		case f.messages <- env.Message:
+			f.Receive(env)
+			return true
+		}
 	}
+}
 
-	g.Wait()
+// BeginRequest registers a new pending request and returns its correlation ID
+// and the channel on which its reply is delivered.
+func (f *function) BeginRequest() (uint64, <-chan envelope) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.requests == nil {
+		f.requests = map[uint64]chan envelope{}
+	}
+
+	f.lastRequestID++
+	id := f.lastRequestID
+
+	// The channel is buffered so that the first reply can be accepted without
+	// blocking the replier's message pump.
+	replies := make(chan envelope, 1)
+	f.requests[id] = replies
+
+	return id, replies
+}
+
+// EndRequest removes a pending request.
+func (f *function) EndRequest(id uint64) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	delete(f.requests, id)
+}
+
+// acceptReply passes env to the pending request that it replies to. The reply
+// is discarded if the request is no longer pending, or if it has already
+// received a reply.
+func (f *function) acceptReply(env envelope) {
+	f.m.Lock()
+	replies, ok := f.requests[env.CorrelationID]
+	f.m.Unlock()
+
+	if ok {
+		select {
+		case replies <- env:
+		default:
+		}
+	}
 }
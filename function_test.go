@@ -0,0 +1,165 @@
+package minibus_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func BenchmarkRun_delivery(b *testing.B) {
+	for _, n := range []int{1, 2, 5} {
+		b.Run(fmt.Sprintf("%d subscriber(s)", n), func(b *testing.B) {
+			benchmarkDelivery(b, n)
+		})
+	}
+}
+
+func BenchmarkRun_bufferedDelivery(b *testing.B) {
+	for _, n := range []int{1, 2, 5} {
+		b.Run(fmt.Sprintf("%d subscriber(s)", n), func(b *testing.B) {
+			benchmarkDelivery(b, n, WithInboxBuffer(100))
+		})
+	}
+}
+
+func BenchmarkRun_bufferedOutbox(b *testing.B) {
+	for _, n := range []int{1, 2, 5} {
+		b.Run(fmt.Sprintf("%d subscriber(s)", n), func(b *testing.B) {
+			benchmarkDelivery(b, n, WithOutboxBuffer(100))
+		})
+	}
+}
+
+func BenchmarkRun_limitedDelivery(b *testing.B) {
+	for _, n := range []int{1, 2, 5} {
+		b.Run(fmt.Sprintf("%d subscriber(s)", n), func(b *testing.B) {
+			benchmarkDelivery(b, n, WithDeliveryConcurrency(2))
+		})
+	}
+}
+
+func BenchmarkRun_pooledDelivery(b *testing.B) {
+	for _, n := range []int{1, 2, 5} {
+		b.Run(fmt.Sprintf("%d subscriber(s)", n), func(b *testing.B) {
+			benchmarkDelivery(b, n, WithDeliveryWorkers(0))
+		})
+	}
+}
+
+func BenchmarkRun_inlineDelivery(b *testing.B) {
+	for _, n := range []int{1, 2, 5} {
+		b.Run(fmt.Sprintf("%d subscriber(s)", n), func(b *testing.B) {
+			benchmarkDelivery(b, n, WithInlineDelivery())
+		})
+	}
+}
+
+func BenchmarkRun_pingPong(b *testing.B) {
+	for _, n := range []int{2, 5} {
+		b.Run(fmt.Sprintf("fan-out/%d subscriber(s)", n), func(b *testing.B) {
+			benchmarkPingPong(b, n)
+		})
+
+		b.Run(fmt.Sprintf("inline/%d subscriber(s)", n), func(b *testing.B) {
+			benchmarkPingPong(b, n, WithInlineDelivery())
+		})
+	}
+}
+
+// benchmarkDelivery measures the cost of delivering messages from a single
+// sender to n subscribers.
+func benchmarkDelivery(b *testing.B, n int, options ...Option) {
+	b.ReportAllocs()
+
+	subscriber := func(ctx context.Context) error {
+		Subscribe[int](ctx)
+		Ready(ctx)
+
+		for range b.N {
+			if _, err := Receive(ctx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	sender := func(ctx context.Context) error {
+		Ready(ctx)
+		b.ResetTimer()
+
+		for i := range b.N {
+			if err := Send(ctx, i); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	options = append(
+		options,
+		WithFunc(sender),
+		Fork(n, subscriber),
+	)
+
+	if err := Run(context.Background(), options...); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// benchmarkPingPong measures the cost of a round-trip between a function that
+// sends a message to n subscribers, and those subscribers, which each reply
+// before the next message is sent.
+func benchmarkPingPong(b *testing.B, n int, options ...Option) {
+	b.ReportAllocs()
+
+	ping := func(ctx context.Context) error {
+		Subscribe[int](ctx)
+		Ready(ctx)
+		b.ResetTimer()
+
+		for range b.N {
+			if err := Send(ctx, "<ping>"); err != nil {
+				return err
+			}
+
+			for range n {
+				if _, err := Receive(ctx); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	pong := func(ctx context.Context) error {
+		Subscribe[string](ctx)
+		Ready(ctx)
+
+		for i := range b.N {
+			if _, err := Receive(ctx); err != nil {
+				return err
+			}
+
+			if err := Send(ctx, i); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	options = append(
+		options,
+		WithFunc(ping),
+		Fork(n, pong),
+	)
+
+	if err := Run(context.Background(), options...); err != nil {
+		b.Fatal(err)
+	}
+}
@@ -2,9 +2,41 @@ package minibus
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ErrOutboxClosed is returned by [Send] when the calling function has closed
+// its outbox by calling [CloseOutbox].
+var ErrOutboxClosed = errors.New("minibus: outbox is closed")
+
+// ErrNotPublished is returned by [Send] and its variants when the
+// [WithStrictPublications] option is used and the calling function has not
+// declared the message's type using [Publish].
+var ErrNotPublished = errors.New("minibus: message type is not published by the sender")
+
+// ErrNoHandler is wrapped by the error returned by [ReceiveSwitch] when there
+// is no handler for the received message.
+var ErrNoHandler = errors.New("minibus: no handler for message")
+
+// ErrTypeNotAllowed is wrapped by the error returned by [Run] when a function
+// sends a message of a type that is not allowed by the [WithAllowedTypes]
+// option.
+var ErrTypeNotAllowed = errors.New("minibus: message type is not allowed")
+
+// ErrInboxClosed is returned by [Receive] when the calling function's inbox has
+// been closed because the session is shutting down, or because the function
+// called [Stop].
+var ErrInboxClosed = errors.New("minibus: inbox is closed")
+
 // Subscribe configures the calling function to receive messages of type M in
 // its inbox.
 //
@@ -16,7 +48,135 @@ func Subscribe[M any](ctx context.Context) {
 		panic("minibus: Subscribe() must not be called after calling Ready()")
 	}
 
-	f.Subscriptions.Add(f, reflect.TypeFor[M]())
+	f.Subscribe(ctx, reflect.TypeFor[M](), nil)
+}
+
+// SubscribeFilter configures the calling function to receive messages of type
+// M in its inbox, but only those for which pred returns true.
+//
+// pred is called before the message is placed in the inbox, so messages that
+// are filtered out never need to be received. It is called by the message pump
+// of the sending function, so it may be called concurrently with the calling
+// function and with itself. It should be fast and must not block.
+//
+// If the function subscribes to M more than once, only the most recent
+// subscription applies. If it receives a message by way of several
+// subscriptions, such as to both M and an interface that M implements, the
+// message is delivered if any of those subscriptions accept it.
+//
+// It may only be called within a function that has been called by [Run]. It
+// must be called before [Ready].
+func SubscribeFilter[M any](ctx context.Context, pred func(M) bool) {
+	if pred == nil {
+		panic("minibus: SubscribeFilter() must not be called with a nil predicate")
+	}
+
+	f := caller(ctx)
+	if f.ReadySignal == nil {
+		panic("minibus: SubscribeFilter() must not be called after calling Ready()")
+	}
+
+	f.Subscribe(
+		ctx,
+		reflect.TypeFor[M](),
+		func(m any) bool {
+			v, _ := m.(M)
+			return pred(v)
+		},
+	)
+}
+
+// Unsubscribe stops the calling function from receiving messages of type M in
+// its inbox.
+//
+// It reverses the effect of a prior call to [Subscribe] with the same type. If
+// M is an interface, the function no longer receives messages that implement
+// M, unless it also subscribes to those messages by some other means.
+//
+// Unlike [Subscribe], it may be called after [Ready]. A message of type M that
+// is already being delivered when Unsubscribe is called may still be received.
+//
+// It may only be called within a function that has been called by [Run].
+func Unsubscribe[M any](ctx context.Context) {
+	f := caller(ctx)
+	f.Unsubscribe(ctx, reflect.TypeFor[M]())
+}
+
+// SubscribeAny configures the calling function to receive messages of any of
+// the given types in its inbox.
+//
+// It is equivalent to calling [Subscribe] once for each type, but is useful
+// when the types are only known at runtime. It panics if any of the types are
+// nil, or if the same type appears more than once.
+//
+// It may only be called within a function that has been called by [Run]. It
+// must be called before [Ready].
+func SubscribeAny(ctx context.Context, types ...reflect.Type) {
+	f := caller(ctx)
+	if f.ReadySignal == nil {
+		panic("minibus: SubscribeAny() must not be called after calling Ready()")
+	}
+
+	seen := map[reflect.Type]struct{}{}
+
+	for _, t := range types {
+		if t == nil {
+			panic("minibus: SubscribeAny() must not be called with a nil type")
+		}
+
+		if _, ok := seen[t]; ok {
+			panic("minibus: SubscribeAny() must not be called with duplicate types, " + t.String() + " appears more than once")
+		}
+
+		seen[t] = struct{}{}
+	}
+
+	for _, t := range types {
+		f.Subscribe(ctx, t, nil)
+	}
+}
+
+// Publish declares that the calling function sends messages of type M.
+//
+// If M is an interface, the declaration covers any message that is routed as a
+// type that implements M. If the [WithStrictPublications] option is used,
+// [Send] and its variants return [ErrNotPublished] for messages of any type
+// that has not been declared. Declarations are also used to check the
+// session's topology once all functions are ready, as per [WithOutputTypes].
+//
+// It may only be called within a function that has been called by [Run]. It
+// must be called before [Ready].
+func Publish[M any](ctx context.Context) {
+	f := caller(ctx)
+	if f.ReadySignal == nil {
+		panic("minibus: Publish() must not be called after calling Ready()")
+	}
+
+	f.Publish(ctx, reflect.TypeFor[M]())
+}
+
+// Subscriptions returns the message types that the calling function receives,
+// sorted by name.
+//
+// It includes the types passed to [Subscribe] and its variants, along with any
+// types that have been sent by other functions that the calling function
+// receives because they implement an interface that it subscribes to.
+//
+// It may only be called within a function that has been called by [Run].
+func Subscriptions(ctx context.Context) []reflect.Type {
+	f := caller(ctx)
+	return f.Subscriptions.Types(f)
+}
+
+// Peers returns the number of other functions executed by the same call to
+// [Run] that are still running.
+//
+// The result is a snapshot; functions may return, or be started by [Spawn],
+// at any time.
+//
+// It may only be called within a function that has been called by [Run].
+func Peers(ctx context.Context) int {
+	return int(caller(ctx).Live.Load()) - 1
 }
 
 // Ready signals that the function has made all relevant [Subscribe] calls and
@@ -30,15 +190,79 @@ func Ready(ctx context.Context) {
 		return
 	}
 
+	// The event is emitted before signaling readiness so that it precedes any
+	// message that is exchanged once the barrier is open.
+	f.emit(FuncReady{f.Name})
+
 	select {
 	case <-ctx.Done():
-	case f.ReadySignal <- struct{}{}:
+	case f.ReadySignal <- f:
 	}
 
 	// We mark the function as ready even if the context is canceled, so that
 	// any logic that checks the flag behaves the same regardless of we're going
 	// to stop or keep running.
 	f.ReadySignal = nil
+
+	f.log(
+		ctx,
+		"ready",
+		slog.Int("subscriptions", f.Subscriptions.Count(f)),
+	)
+}
+
+// WaitReady blocks until all functions executed by the same call to [Run] have
+// called [Ready], or returns an error if ctx is canceled.
+//
+// It's useful for a function that needs to start some work only once messages
+// are being exchanged, such as starting a timer. Functions started by [Spawn]
+// never wait, as the other functions are already ready.
+//
+// It may only be called within a function that has been called by [Run]. It
+// must be called after [Ready].
+func WaitReady(ctx context.Context) error {
+	f := caller(ctx)
+	if f.ReadySignal != nil {
+		panic("minibus: WaitReady() must not be called before calling Ready()")
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-f.ReadyLatch:
+		return nil
+	}
+}
+
+// Name returns the name of the calling function, as given to [WithNamedFunc].
+//
+// If the function was not given a name, it returns the name of the Go function
+// that implements it.
+//
+// It may only be called within a function that has been called by [Run].
+func Name(ctx context.Context) string {
+	return caller(ctx).Name
+}
+
+// Warn reports a problem that the calling function has recovered from, without
+// returning an error and shutting down the session.
+//
+// The warning is logged at [slog.LevelWarn], with err as its "error" attribute,
+// and passed to the function configured by the [WithWarningHandler] option, if
+// any. It panics if err is nil.
+//
+// It may only be called within a function that has been called by [Run].
+func Warn(ctx context.Context, err error) {
+	if err == nil {
+		panic("minibus: Warn() must not be called with a nil error")
+	}
+
+	f := caller(ctx)
+	f.warn(ctx, "warning", slog.Any("error", err))
+
+	if f.Config.WarningHandler != nil {
+		f.Config.WarningHandler(ctx, f.Name, err)
+	}
 }
 
 // Inbox returns the channel on which the function receives messages send by
@@ -49,8 +273,12 @@ func Ready(ctx context.Context) {
 //
 // No messages are delivered until all functions executed by the same call to
 // [Run] have called [Ready].
+//
+// A function may continue to receive messages using [Receive] (or helpers
+// built upon it, such as [ReceiveAs]) after calling Inbox. Each message is
+// received either from the channel or by [Receive], never both.
 func Inbox(ctx context.Context) <-chan any {
-	return caller(ctx).Inbox
+	return caller(ctx).Messages()
 }
 
 // Outbox returns a channel on which the function can send messages to other
@@ -58,26 +286,620 @@ func Inbox(ctx context.Context) <-chan any {
 //
 // The channel will block until all functions executed by the same call to [Run]
 // have called [Ready].
+//
+// The channel may be used by multiple goroutines started by the function, but
+// those goroutines must finish sending before the function returns. Messages
+// sent after the function has returned are never delivered.
 func Outbox(ctx context.Context) chan<- any {
-	return caller(ctx).Outbox
+	f := caller(ctx)
+	f.Deadlock.Disable()
+	return f.Outbox
 }
 
 // Send sends a message, or returns an error if ctx is canceled.
+//
+// The message is delivered to the functions that subscribe to its dynamic type,
+// or to any interface that it implements. A nil message is delivered to the
+// functions that subscribe to [any].
+//
+// It returns [ErrOutboxClosed] if the function has called [CloseOutbox], an
+// error that wraps [ErrNotPublished] if the [WithStrictPublications] option is
+// used and the message's type has not been declared using [Publish], or an
+// error that wraps [ErrQueueFull] if the [WithMaxQueueDepth] option is used
+// and there are already too many undelivered messages of the same type.
+//
+// Messages sent by the same goroutine are received by each subscriber in the
+// order that they were sent. There is no ordering guarantee between messages
+// sent by different functions, unless the [WithTotalOrder] option is used.
+//
+// If the [WithContextValues] option is used, the values of the given keys are
+// captured from ctx and made available to the recipients via [MessageContext].
+//
+// If the [WithTracer] option is used, Send records a span named
+// "minibus.publish <type>" as a child of the span in ctx, if any.
+//
+// It is safe to call Send concurrently from multiple goroutines started by the
+// function. Each message that is sent successfully is delivered once to each
+// subscriber that is still running, however there is no ordering guarantee
+// between messages sent by different goroutines.
 func Send(ctx context.Context, m any) error {
+	f := caller(ctx)
+
+	select {
+	case <-f.OutboxLatch:
+		return ErrOutboxClosed
+	default:
+	}
+
+	if f.Config.StrictPublications {
+		if t := envelopeOf(m).Type; !f.IsPublished(t) {
+			return fmt.Errorf("%w: %s", ErrNotPublished, t)
+		}
+	}
+
+	if f.Config.Copy != nil {
+		m = f.copyMessage(m)
+	}
+
+	if len(f.Config.ContextKeys) != 0 {
+		m = f.captureContextValues(ctx, m)
+	}
+
+	if f.Config.Tracer != nil {
+		var span trace.Span
+		m, span = f.startPublishSpan(ctx, m)
+		defer span.End()
+	}
+
+	if f.isCollected() {
+		m = stamp(m)
+	}
+
+	// expired is only non-nil if the send has a timeout, as per
+	// [WithDeliveryPolicy].
+	var expired <-chan time.Time
+	if d := f.Config.DeliveryPolicy.Timeout; d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var depth *queueDepth
+	if f.Config.QueueDepth != nil {
+		env := envelopeOf(m)
+		if depth = f.Config.QueueDepth[env.Type]; depth != nil {
+			if ok, err := f.reserve(ctx, depth, env.Type, expired); !ok {
+				return err
+			}
+			env.Depth = depth
+			m = env
+		}
+	}
+
+	// The message is pending until it has been delivered to, and received by,
+	// all of its recipients.
+	f.Deadlock.Add(1)
+
+	select {
+	case <-ctx.Done():
+		f.Deadlock.Add(-1)
+		depth.Add(-1)
+		return ctx.Err()
+	case <-f.OutboxLatch:
+		f.Deadlock.Add(-1)
+		depth.Add(-1)
+		return ErrOutboxClosed
+	case <-expired:
+		f.Deadlock.Add(-1)
+		depth.Add(-1)
+		return ErrSendTimeout
+	case f.Outbox <- m:
+		return nil
+	}
+}
+
+// SendRetry sends a message, retrying up to the given number of attempts if it
+// fails for a transient reason.
+//
+// The transient failures are [ErrQueueFull], which is returned when the
+// [WithMaxQueueDepth] option is used and the recipients of the message's type
+// have fallen behind, and [ErrSendTimeout], which is returned when the timeout
+// set by [WithDeliveryPolicy] elapses. Other errors, such as the cancellation
+// of ctx, are returned immediately. SendRetry waits for backoff before the first retry,
+// and doubles the wait before each subsequent retry. If attempts is zero, it
+// retries until the message is sent or ctx is canceled.
+//
+// It returns the error from the final attempt if every attempt fails. It
+// panics if attempts or backoff is negative.
+func SendRetry(ctx context.Context, m any, attempts int, backoff time.Duration) error {
+	if attempts < 0 {
+		panic("minibus: SendRetry() must not be called with a negative number of attempts")
+	}
+	if backoff < 0 {
+		panic("minibus: SendRetry() must not be called with a negative backoff")
+	}
+
+	clock := caller(ctx).Config.Clock
+
+	for attempt := 1; ; attempt++ {
+		err := Send(ctx, m)
+		if !isTransient(err) || attempt == attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.After(backoff):
+		}
+
+		if backoff <= math.MaxInt64/2 {
+			backoff *= 2
+		}
+	}
+}
+
+// isTransient returns true if err indicates that a send failed for a reason
+// that may not apply if it's retried.
+func isTransient(err error) bool {
+	return errors.Is(err, ErrQueueFull) || errors.Is(err, ErrSendTimeout)
+}
+
+// Broadcast sends each of the given messages in order, or returns an error if
+// ctx is canceled.
+//
+// It's equivalent to calling [Send] for each message in turn, stopping at the
+// first error. Because the messages are sent from a single goroutine, each
+// subscriber receives them in the order given.
+func Broadcast(ctx context.Context, messages ...any) error {
+	for _, m := range messages {
+		if err := Send(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendSync sends a message and waits until it has been delivered, or returns an
+// error if ctx is canceled.
+//
+// Unlike [Send], which returns as soon as the message has been accepted for
+// delivery, SendSync blocks until the message has been placed in each
+// recipient's inbox. It does not wait for the recipients to receive the
+// message or to handle it; the message may still be waiting in an inbox
+// buffer, as per [WithInboxBuffer], or in the channel returned by [Inbox] or
+// [Channel], when SendSync returns.
+//
+// The recipients are the subscribers at the time the message is sent;
+// functions that subscribe later do not receive it, and functions that return
+// before accepting it are not waited for.
+//
+// It returns an error if ctx is canceled, or if [Run] begins to shut down,
+// before the message is delivered to every recipient.
+func SendSync(ctx context.Context, m any) error {
+	done := make(chan bool, 1)
+
+	env := envelopeOf(m)
+	env.Done = done
+
+	if err := Send(ctx, env); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case ok := <-done:
+		if !ok {
+			return errDeliveryInterrupted
+		}
+		return nil
+	}
+}
+
+// errDeliveryInterrupted is returned by [SendSync] when the message could not
+// be delivered to all of its recipients because [Run] is shutting down.
+var errDeliveryInterrupted = errors.New("minibus: delivery was interrupted because the session is shutting down")
+
+// SendAck sends a message, or returns an error if ctx is canceled. It returns a
+// channel that is closed once the message has been delivered to each inbox.
+//
+// Like [Send], it returns as soon as the message has been accepted for
+// delivery. The returned channel is closed once the message has been accepted
+// into each recipient's inbox, allowing the sender to continue working while
+// the message is delivered, and to wait for it later, as with [SendSync]. As
+// with [SendSync], a message that is accepted into an inbox buffer, as per
+// [WithInboxBuffer], may not yet have been received.
+//
+// The channel is closed immediately after the message is routed if it has no
+// recipients. It is never closed if [Run] begins to shut down before the
+// message is delivered to every recipient.
+func SendAck(ctx context.Context, m any) (<-chan struct{}, error) {
+	ack := make(chan struct{})
+
+	env := envelopeOf(m)
+	env.Ack = ack
+
+	if err := Send(ctx, env); err != nil {
+		return nil, err
+	}
+
+	return ack, nil
+}
+
+// SendRetained sends a message, or returns an error if ctx is canceled, and
+// retains it for functions that subscribe to its type later.
+//
+// The message is delivered to the current subscribers in the same way as
+// [Send]. It also replaces any message of the same type that was previously
+// retained, such that at most one message of each type is retained. A function
+// started by [Spawn] that subscribes to a type after a message of that type is
+// retained receives the retained message once it calls [Ready], as though it
+// had been subscribed when the message was sent.
+//
+// It is useful for broadcasting configuration or state that late-joining
+// functions need, without the sender having to send it again. There is no
+// ordering guarantee between a retained message that is replayed to a
+// function, and other messages sent to that function.
+func SendRetained(ctx context.Context, m any) error {
+	env := envelopeOf(m)
+	env.IsRetained = true
+
+	return Send(ctx, env)
+}
+
+// SendAs sends a message of type M, or returns an error if ctx is canceled.
+//
+// Unlike [Send], which routes a message according to its dynamic type, SendAs
+// routes the message according to M. When M is an interface, the message is
+// delivered to functions that subscribe to M (or to interfaces that M
+// implements), but not to functions that only subscribe to the message's
+// concrete type.
+//
+// For example, SendAs[io.Reader](ctx, f) delivers f to functions subscribed to
+// [io.Reader], even if no function subscribes to [*os.File].
+func SendAs[M any](ctx context.Context, m M) error {
+	return Send(
+		ctx,
+		envelope{
+			Type:    reflect.TypeFor[M](),
+			Message: m,
+		},
+	)
+}
+
+// CloseOutbox signals that the calling function will not send any more
+// messages. It allows a function to stop producing messages while it continues
+// to consume them.
+//
+// It blocks until any message that has already been accepted by [Send] has
+// been delivered, or until ctx is canceled. Any subsequent calls to [Send]
+// return [ErrOutboxClosed]. The channel returned by [Outbox] is never read
+// again, so sending to it directly blocks until ctx is canceled.
+//
+// It must be called after [Ready].
+func CloseOutbox(ctx context.Context) error {
+	f := caller(ctx)
+	if f.ReadySignal != nil {
+		panic("minibus: CloseOutbox() must not be called before calling Ready()")
+	}
+
+	f.CloseOutbox()
+
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
-	case Outbox(ctx) <- m:
+	case <-f.PumpLatch:
 		return nil
 	}
 }
 
 // Receive returns the next received message, or an error if ctx is canceled.
+//
+// It returns [ErrInboxClosed] if the inbox is closed before a message is
+// received, allowing a nil message to be distinguished from shutdown.
 func Receive(ctx context.Context) (any, error) {
+	f := caller(ctx)
+
+	// Check for a stop first, as messages may still be waiting in the inbox.
+	select {
+	case <-f.StopLatch:
+		return nil, inboxClosedError(ctx)
+	default:
+	}
+
+	inbox := f.inbox()
+	receiving := f.beginReceive(ctx)
+
 	select {
 	case <-ctx.Done():
+		f.endReceive(receiving)
 		return nil, ctx.Err()
-	case m := <-Inbox(ctx):
-		return m, nil
+	case <-f.StopLatch:
+		f.endReceive(receiving)
+		return nil, inboxClosedError(ctx)
+	case env, ok := <-inbox:
+		f.endReceive(receiving)
+		if !ok {
+			return nil, inboxClosedError(ctx)
+		}
+		return f.Receive(env), nil
+	}
+}
+
+// ReceiveTimeout returns the next received message, or an error if no message
+// is received within d, or ctx is canceled.
+//
+// If no message is received within d it returns [context.DeadlineExceeded].
+func ReceiveTimeout(ctx context.Context, d time.Duration) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	return Receive(ctx)
+}
+
+// ReceiveBatch returns up to max received messages, or an error if ctx is
+// canceled.
+//
+// It blocks until at least one message is received. It then continues to
+// receive any messages that are already waiting in the inbox, and any that
+// arrive within maxWait of the first message being received, until it has
+// received max messages. If maxWait is zero it does not wait for further
+// messages.
+//
+// If the inbox is closed, or ctx is canceled, after at least one message has
+// been received, it returns the messages received so far along with the error.
+//
+// It panics if max is less than one.
+func ReceiveBatch(ctx context.Context, max int, maxWait time.Duration) ([]any, error) {
+	if max < 1 {
+		panic("minibus: ReceiveBatch() must be called with a maximum batch size of at least one")
+	}
+
+	f := caller(ctx)
+
+	m, err := Receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := []any{m}
+	inbox := f.inbox()
+
+	var timeout <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for len(batch) < max {
+		select {
+		case <-f.StopLatch:
+			return batch, inboxClosedError(ctx)
+		case env, ok := <-inbox:
+			if !ok {
+				return batch, inboxClosedError(ctx)
+			}
+			batch = append(batch, f.Receive(env))
+			continue
+		default:
+		}
+
+		// The inbox is empty, wait for more messages until the timeout.
+		select {
+		case <-ctx.Done():
+			return batch, ctx.Err()
+		case <-timeout:
+			return batch, nil
+		case <-f.StopLatch:
+			return batch, inboxClosedError(ctx)
+		case env, ok := <-inbox:
+			if !ok {
+				return batch, inboxClosedError(ctx)
+			}
+			batch = append(batch, f.Receive(env))
+		}
+	}
+
+	return batch, nil
+}
+
+// ReceiveAs returns the next received message as a value of type M, or an
+// error if ctx is canceled.
+//
+// It returns an error if the received message is not assignable to M. It is
+// intended for functions that only subscribe to M (or types assignable to M).
+func ReceiveAs[M any](ctx context.Context) (M, error) {
+	m, err := Receive(ctx)
+	if err != nil {
+		var zero M
+		return zero, err
+	}
+
+	return as[M](m)
+}
+
+// as returns m as a value of type M, or an error if it is not assignable to M.
+func as[M any](m any) (M, error) {
+	if v, ok := m.(M); ok {
+		return v, nil
+	}
+
+	var zero M
+
+	t := reflect.TypeFor[M]()
+	if m == nil && t.Kind() == reflect.Interface {
+		return zero, nil
+	}
+
+	return zero, fmt.Errorf("minibus: received message of type %T, which is not assignable to %s", m, t)
+}
+
+// ReceiveFunc calls fn with each received message until the inbox is closed,
+// fn returns an error, or ctx is canceled.
+//
+// It returns nil if the inbox is closed, which occurs when the session is
+// shutting down. Otherwise, it returns the error returned by fn, or the
+// context's error.
+func ReceiveFunc(ctx context.Context, fn func(ctx context.Context, m any) error) error {
+	f := caller(ctx)
+
+	for {
+		inbox := f.inbox()
+		receiving := f.beginReceive(ctx)
+
+		select {
+		case <-ctx.Done():
+			f.endReceive(receiving)
+			return ctx.Err()
+		case <-f.StopLatch:
+			f.endReceive(receiving)
+			return nil
+		case env, ok := <-inbox:
+			f.endReceive(receiving)
+			if !ok {
+				return nil
+			}
+			if err := f.Handle(ctx, f.Receive(env), fn); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ReceiveFuncAs calls fn with each received message that is assignable to M,
+// until the inbox is closed, fn returns an error, or ctx is canceled.
+//
+// Received messages that are not assignable to M are ignored. Otherwise, it
+// behaves like [ReceiveFunc].
+func ReceiveFuncAs[M any](ctx context.Context, fn func(ctx context.Context, m M) error) error {
+	return ReceiveFunc(
+		ctx,
+		func(ctx context.Context, m any) error {
+			if v, ok := m.(M); ok {
+				return fn(ctx, v)
+			}
+			return nil
+		},
+	)
+}
+
+// ReceiveSwitch receives the next message and calls the handler for its type,
+// or returns an error if ctx is canceled. It returns the type of the handler
+// that was called, allowing the caller to tell which kind of message it
+// received.
+//
+// The message is passed to the handler for its dynamic type, if there is one.
+// Otherwise, it's passed to the first handler (in lexical order of type name)
+// for an interface that the message implements. A handler for [any] is only
+// called for messages that no other handler matches, including nil messages,
+// so it may be used to handle, or ignore, any other message.
+//
+// It returns the error returned by the handler. If no handler matches the
+// message, it returns the message's dynamic type and an error that wraps
+// [ErrNoHandler]. If no message is received, the type is nil.
+//
+// It panics if any of the handlers, or their types, are nil.
+func ReceiveSwitch(ctx context.Context, handlers map[reflect.Type]func(any) error) (reflect.Type, error) {
+	d := &dispatcher{}
+
+	for t, h := range handlers {
+		if t == nil {
+			panic("minibus: ReceiveSwitch() must not be called with a nil type")
+		}
+
+		if h == nil {
+			panic("minibus: ReceiveSwitch() must not be called with a nil handler for " + t.String())
+		}
+
+		fn := func(_ context.Context, m any) error {
+			return h(m)
+		}
+
+		if t == anyType {
+			d.Default = fn
+		} else {
+			d.Add(t, fn)
+		}
+	}
+
+	// The types are sorted so that messages that implement several of the
+	// interfaces are consistently passed to the same handler.
+	slices.SortFunc(
+		d.Types,
+		func(a, b reflect.Type) int {
+			return strings.Compare(a.String(), b.String())
+		},
+	)
+
+	m, err := Receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t, h := d.handlerFor(reflect.TypeOf(m))
+	if h == nil {
+		return reflect.TypeOf(m), fmt.Errorf("%w of type %T", ErrNoHandler, m)
+	}
+
+	return t, caller(ctx).Handle(ctx, m, h)
+}
+
+// inboxClosedError returns the error to report when the inbox is closed. The
+// context error takes precedence, as the inbox is closed during shutdown.
+func inboxClosedError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ErrInboxClosed
+}
+
+// Stop stops the calling function from receiving any further messages, allowing
+// it to finish its work without shutting down the rest of the session.
+//
+// The function's subscriptions are removed, and its inbox behaves as though it
+// has been closed: [Receive] returns [ErrInboxClosed], the channel returned by
+// [Inbox] is closed, and [ReceiveFunc] returns nil. Messages that are already
+// waiting in the inbox are discarded. The function may continue to send
+// messages until it returns.
+//
+// Unlike shutting down the session, the other functions continue to exchange
+// messages. [Run] still waits for the calling function to return.
+//
+// It may only be called within a function that has been called by [Run].
+func Stop(ctx context.Context) {
+	f := caller(ctx)
+	f.Stop(ctx)
+}
+
+// Spawn starts fn as an additional function within the same call to [Run] as
+// the calling function.
+//
+// The spawned function is called in its own goroutine, and [Run] waits for it
+// to return, just like the functions added by [WithFunc]. Because the other
+// functions are already exchanging messages, the spawned function does not
+// wait for them. It may receive messages as soon as it subscribes to them, and
+// the messages it sends are delivered as soon as it calls [Ready].
+//
+// It returns an error if ctx is canceled before the function is started.
+//
+// It may only be called within a function that has been called by [Run]. It
+// must be called after [Ready].
+func Spawn(ctx context.Context, fn Func, options ...FuncOption) error {
+	if fn == nil {
+		panic("minibus: Spawn() must not be called with a nil function")
+	}
+
+	f := caller(ctx)
+	if f.ReadySignal != nil {
+		panic("minibus: Spawn() must not be called before calling Ready()")
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case f.SpawnSignal <- newFuncConfig(fn, funcName(fn), options):
+		return nil
 	}
 }
@@ -0,0 +1,1239 @@
+package minibus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestSubscribeAny(t *testing.T) {
+	t.Run("it delivers messages of each type passed to SubscribeAny", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		// Build the list of types at runtime, as a dispatcher that loads its
+		// configuration from a registry would.
+		messages := []any{"<message>", 42, &reader{"<reader>"}}
+
+		var types []reflect.Type
+		for _, m := range messages {
+			types = append(types, reflect.TypeOf(m))
+		}
+
+		var received []any
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					SubscribeAny(ctx, types...)
+					Ready(ctx)
+
+					for range messages {
+						m, err := Receive(ctx)
+						if err != nil {
+							return err
+						}
+						received = append(received, m)
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for _, m := range messages {
+						if err := Send(ctx, m); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if !slices.Equal(received, messages) {
+			t.Fatalf("unexpected messages: got %v, want %v", received, messages)
+		}
+	})
+
+	t.Run("it panics if SubscribeAny is called after Ready", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var recovered any
+
+		Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					defer func() {
+						recovered = recover()
+					}()
+
+					Ready(ctx)
+					SubscribeAny(ctx, reflect.TypeFor[string]())
+
+					return nil
+				},
+			),
+		)
+
+		if recovered == nil {
+			t.Fatal("expected a panic")
+		}
+	})
+
+	t.Run("it panics if SubscribeAny is called with duplicate types", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var recovered any
+
+		Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					defer func() {
+						recovered = recover()
+					}()
+
+					SubscribeAny(
+						ctx,
+						reflect.TypeFor[string](),
+						reflect.TypeFor[string](),
+					)
+
+					return nil
+				},
+			),
+		)
+
+		if recovered == nil {
+			t.Fatal("expected a panic")
+		}
+	})
+}
+
+func TestSubscribeFilter(t *testing.T) {
+	t.Run("it only delivers messages accepted by the filter passed to SubscribeFilter", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var even, odd []int
+
+		receiver := func(out *[]int, pred func(int) bool) Func {
+			return func(ctx context.Context) error {
+				SubscribeFilter(ctx, pred)
+				Ready(ctx)
+
+				for range 5 {
+					m, err := ReceiveAs[int](ctx)
+					if err != nil {
+						return err
+					}
+					*out = append(*out, m)
+				}
+
+				return nil
+			}
+		}
+
+		err := Run(
+			ctx,
+			WithFunc(
+				receiver(
+					&even,
+					func(m int) bool { return m%2 == 0 },
+				),
+			),
+			WithFunc(
+				receiver(
+					&odd,
+					func(m int) bool { return m%2 != 0 },
+				),
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range 10 {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if want := []int{0, 2, 4, 6, 8}; !slices.Equal(even, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", even, want)
+		}
+
+		if want := []int{1, 3, 5, 7, 9}; !slices.Equal(odd, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", odd, want)
+		}
+	})
+}
+
+func TestUnsubscribe(t *testing.T) {
+	t.Run("it does not deliver messages of a type that has been unsubscribed", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		type unsubscribed struct{}
+
+		for _, tc := range []struct {
+			Name                   string
+			Subscribe, Unsubscribe func(context.Context)
+		}{
+			{"concrete type", Subscribe[*reader], Unsubscribe[*reader]},
+			{"interface type", Subscribe[io.Reader], Unsubscribe[io.Reader]},
+		} {
+			t.Run(tc.Name, func(t *testing.T) {
+				err := Run(
+					ctx,
+					WithFunc(
+						func(ctx context.Context) error {
+							tc.Subscribe(ctx)
+							Subscribe[int](ctx)
+							Ready(ctx)
+
+							if _, err := ReceiveAs[*reader](ctx); err != nil {
+								return err
+							}
+
+							tc.Unsubscribe(ctx)
+
+							if err := Send(ctx, unsubscribed{}); err != nil {
+								return err
+							}
+
+							m, err := Receive(ctx)
+							if err != nil {
+								return err
+							}
+
+							if _, ok := m.(int); !ok {
+								return fmt.Errorf("received a message after unsubscribing: %v", m)
+							}
+
+							return nil
+						},
+					),
+					WithFunc(
+						func(ctx context.Context) error {
+							Subscribe[unsubscribed](ctx)
+							Ready(ctx)
+
+							if err := Send(ctx, &reader{"<before>"}); err != nil {
+								return err
+							}
+
+							if _, err := Receive(ctx); err != nil {
+								return err
+							}
+
+							if err := Send(ctx, &reader{"<after>"}); err != nil {
+								return err
+							}
+
+							return Send(ctx, 42)
+						},
+					),
+				)
+
+				if err != nil {
+					t.Fatalf("Run() returned an unexpected error: %s", err)
+				}
+			})
+		}
+	})
+}
+
+func TestSubscriptions(t *testing.T) {
+	t.Run("it returns the types the function receives from Subscriptions", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var before, after []reflect.Type
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Subscribe[io.Reader](ctx)
+
+					// Called before Ready, so that no messages can have been
+					// sent yet.
+					before = Subscriptions(ctx)
+					Ready(ctx)
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+
+					after = Subscriptions(ctx)
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, &reader{"<reader>"})
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		want := []reflect.Type{
+			reflect.TypeFor[io.Reader](),
+			reflect.TypeFor[string](),
+		}
+
+		if !slices.Equal(before, want) {
+			t.Fatalf("unexpected subscriptions before delivery: got %v, want %v", before, want)
+		}
+
+		want = []reflect.Type{
+			reflect.TypeFor[*reader](),
+			reflect.TypeFor[io.Reader](),
+			reflect.TypeFor[string](),
+		}
+
+		if !slices.Equal(after, want) {
+			t.Fatalf("unexpected subscriptions after delivery: got %v, want %v", after, want)
+		}
+	})
+}
+
+func TestSendAs(t *testing.T) {
+	t.Run("it routes messages sent with SendAs by the static type", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[io.Reader](ctx)
+					Ready(ctx)
+
+					for _, want := range []string{"<interface>", "<concrete>"} {
+						m, err := Receive(ctx)
+						if err != nil {
+							return err
+						}
+
+						if got := m.(*reader).Name; got != want {
+							return fmt.Errorf("interface subscriber received unexpected message: got %q, want %q", got, want)
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[*reader](ctx)
+					Ready(ctx)
+
+					// Messages from a single sender are delivered in order, so
+					// if the message sent with SendAs() were delivered to this
+					// function it would be received first.
+					m, err := Receive(ctx)
+					if err != nil {
+						return err
+					}
+
+					if got, want := m.(*reader).Name, "<concrete>"; got != want {
+						return fmt.Errorf("concrete subscriber received unexpected message: got %q, want %q", got, want)
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := SendAs[io.Reader](ctx, &reader{"<interface>"}); err != nil {
+						return err
+					}
+
+					return Send(ctx, &reader{"<concrete>"})
+				},
+			),
+		)
+
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+}
+
+func TestBroadcast(t *testing.T) {
+	t.Run("it delivers each message passed to Broadcast to its subscribers", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var (
+			s string
+			i int
+			r *reader
+		)
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					var err error
+					s, err = ReceiveAs[string](ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					var err error
+					i, err = ReceiveAs[int](ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[*reader](ctx)
+					Ready(ctx)
+
+					var err error
+					r, err = ReceiveAs[*reader](ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Broadcast(ctx, "<message>", 42, &reader{"<reader>"})
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if s != "<message>" {
+			t.Fatalf("unexpected string message: got %q, want %q", s, "<message>")
+		}
+
+		if i != 42 {
+			t.Fatalf("unexpected int message: got %d, want 42", i)
+		}
+
+		if r == nil || r.Name != "<reader>" {
+			t.Fatalf("unexpected *reader message: got %v, want <reader>", r)
+		}
+	})
+}
+
+func TestSendSync(t *testing.T) {
+	t.Run("it does not return from SendSync until every subscriber has received the message when inboxes are unbuffered", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const count = 3
+		var receiving atomic.Int32
+
+		err := Run(
+			ctx,
+			Fork(
+				count,
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					time.Sleep(20 * time.Millisecond)
+					receiving.Add(1)
+
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := SendSync(ctx, "<message>"); err != nil {
+						return err
+					}
+
+					if n := receiving.Load(); n != count {
+						return fmt.Errorf("SendSync() returned before all subscribers received the message: got %d, want %d", n, count)
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it returns an error from SendSync if the context is canceled before the message is received", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+					<-ctx.Done()
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+					defer cancel()
+
+					return SendSync(ctx, "<message>")
+				},
+			),
+		)
+
+		if err != context.DeadlineExceeded {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestSendAck(t *testing.T) {
+	t.Run("it closes the channel returned by SendAck once the message has been received when inboxes are unbuffered", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received atomic.Bool
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					time.Sleep(20 * time.Millisecond)
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+					received.Store(true)
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					ack, err := SendAck(ctx, "<message>")
+					if err != nil {
+						return err
+					}
+
+					select {
+					case <-ack:
+						return errors.New("ack channel was closed before the message was received")
+					default:
+					}
+
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-ack:
+					}
+
+					if !received.Load() {
+						return errors.New("ack channel was closed before the recipient received the message")
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it closes the channel returned by SendAck if the message has no recipients", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					ack, err := SendAck(ctx, "<message>")
+					if err != nil {
+						return err
+					}
+
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-ack:
+						return nil
+					}
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+}
+
+func TestSendRetained(t *testing.T) {
+	t.Run("it replays the message sent by SendRetained to functions that subscribe later", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var got []string
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := SendRetained(ctx, "<first>"); err != nil {
+						return err
+					}
+
+					return SendRetained(ctx, "<second>")
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					// Wait until both retained messages have been sent.
+					for {
+						m, err := Receive(ctx)
+						if err != nil {
+							return err
+						}
+						if m == "<second>" {
+							break
+						}
+					}
+
+					return Spawn(
+						ctx,
+						func(ctx context.Context) error {
+							Subscribe[string](ctx)
+							Ready(ctx)
+
+							m, err := Receive(ctx)
+							if err != nil {
+								return err
+							}
+							got = append(got, m.(string))
+
+							// Only the most recent retained message is
+							// replayed.
+							if _, err := ReceiveTimeout(ctx, 20*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+								return fmt.Errorf("unexpected error: got %v, want %v", err, context.DeadlineExceeded)
+							}
+
+							return nil
+						},
+					)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if want := []string{"<second>"}; !slices.Equal(got, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("it does not replay messages sent by Send to functions that subscribe later", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, "<message>")
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+
+					return Spawn(
+						ctx,
+						func(ctx context.Context) error {
+							Subscribe[string](ctx)
+							Ready(ctx)
+
+							if _, err := ReceiveTimeout(ctx, 20*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+								return fmt.Errorf("unexpected error: got %v, want %v", err, context.DeadlineExceeded)
+							}
+
+							return nil
+						},
+					)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+}
+
+func TestReceiveAs(t *testing.T) {
+	t.Run("it returns messages of the requested type from ReceiveAs", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					m, err := ReceiveAs[string](ctx)
+					if err != nil {
+						return err
+					}
+
+					if m != "<message>" {
+						return fmt.Errorf("unexpected message: got %q, want %q", m, "<message>")
+					}
+
+					if _, err := ReceiveAs[string](ctx); err == nil {
+						return errors.New("expected an error when receiving a message of the wrong type")
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := Send(ctx, "<message>"); err != nil {
+						return err
+					}
+
+					return Send(ctx, 42)
+				},
+			),
+		)
+
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+}
+
+func TestReceiveTimeout(t *testing.T) {
+	t.Run("it returns the next message from ReceiveTimeout if it arrives in time", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					m, err := ReceiveTimeout(ctx, 500*time.Millisecond)
+					if err != nil {
+						return err
+					}
+
+					if m != "<message>" {
+						return fmt.Errorf("unexpected message: got %v, want <message>", m)
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, "<message>")
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it returns an error from ReceiveTimeout if no message arrives in time", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					_, err := ReceiveTimeout(ctx, 10*time.Millisecond)
+					return err
+				},
+			),
+		)
+
+		if err != context.DeadlineExceeded {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestReceiveBatch(t *testing.T) {
+	t.Run("it returns the messages that arrive within the wait time from ReceiveBatch", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var batches [][]any
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					for range 3 {
+						batch, err := ReceiveBatch(ctx, 5, 50*time.Millisecond)
+						if err != nil {
+							return err
+						}
+						batches = append(batches, batch)
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					// Send a full batch, followed by a partial batch, and
+					// then a partial batch after the wait time has elapsed.
+					for i := range 8 {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					time.Sleep(100 * time.Millisecond)
+
+					return Send(ctx, 8)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if want := "[[0 1 2 3 4] [5 6 7] [8]]"; fmt.Sprint(batches) != want {
+			t.Fatalf("unexpected batches: got %v, want %s", batches, want)
+		}
+	})
+
+	t.Run("it returns the partial batch and ErrInboxClosed from ReceiveBatch when the inbox is closed", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var (
+			batch      []any
+			receiveErr error
+		)
+
+		Run(
+			ctx,
+			WithInboxBuffer(5),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+					<-ctx.Done()
+
+					// Use a context that is not canceled when the session shuts
+					// down, so that the closure of the inbox is observed.
+					batch, receiveErr = ReceiveBatch(context.WithoutCancel(ctx), 5, 1*time.Second)
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range 2 {
+						if err := SendSync(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					return errors.New("<stop>")
+				},
+			),
+		)
+
+		if receiveErr != ErrInboxClosed {
+			t.Fatalf("unexpected error from ReceiveBatch(): got %v, want %q", receiveErr, ErrInboxClosed)
+		}
+
+		if want := "[0 1]"; fmt.Sprint(batch) != want {
+			t.Fatalf("unexpected batch: got %v, want %s", batch, want)
+		}
+	})
+}
+
+func TestReceiveFunc(t *testing.T) {
+	t.Run("it calls the function passed to ReceiveFunc for each received message", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		want := []any{"<message-1>", 42, "<message-2>"}
+		var got []any
+		errDone := errors.New("<done>")
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					return ReceiveFunc(
+						ctx,
+						func(ctx context.Context, m any) error {
+							got = append(got, m)
+							if len(got) == len(want) {
+								return errDone
+							}
+							return nil
+						},
+					)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Broadcast(ctx, want...)
+				},
+			),
+		)
+		if err != errDone {
+			t.Fatalf("unexpected error: got %q, want %q", err, errDone)
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("it returns nil from ReceiveFunc when the inbox is closed", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		errStop := errors.New("<stop>")
+		result := make(chan error, 1)
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					// Use a context that is not canceled when the session shuts
+					// down, so that ReceiveFunc only stops when the inbox is
+					// closed.
+					result <- ReceiveFunc(
+						context.WithoutCancel(ctx),
+						func(context.Context, any) error {
+							return nil
+						},
+					)
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return errStop
+				},
+			),
+		)
+		if err != errStop {
+			t.Fatalf("unexpected error: got %q, want %q", err, errStop)
+		}
+
+		if err := <-result; err != nil {
+			t.Fatalf("ReceiveFunc() returned an unexpected error: %q", err)
+		}
+	})
+}
+
+func TestReceiveFuncAs(t *testing.T) {
+	t.Run("it only calls the function passed to ReceiveFuncAs for messages of the given type", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		want := []string{"<message-1>", "<message-2>"}
+		var got []string
+		errDone := errors.New("<done>")
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					return ReceiveFuncAs(
+						ctx,
+						func(ctx context.Context, m string) error {
+							got = append(got, m)
+							if len(got) == len(want) {
+								return errDone
+							}
+							return nil
+						},
+					)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Broadcast(ctx, "<message-1>", 42, "<message-2>")
+				},
+			),
+		)
+		if err != errDone {
+			t.Fatalf("unexpected error: got %q, want %q", err, errDone)
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestReceiveSwitch(t *testing.T) {
+	t.Run("it calls the handler for the type of each message received by ReceiveSwitch", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var got []string
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Broadcast(ctx, "<message>", 123, 4.5)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Subscribe[int](ctx)
+					Subscribe[float64](ctx)
+					Ready(ctx)
+
+					handlers := map[reflect.Type]func(any) error{
+						reflect.TypeFor[string](): func(m any) error {
+							got = append(got, "string "+m.(string))
+							return nil
+						},
+						reflect.TypeFor[int](): func(m any) error {
+							got = append(got, fmt.Sprintf("int %d", m))
+							return nil
+						},
+						reflect.TypeFor[float64](): func(m any) error {
+							got = append(got, fmt.Sprintf("float64 %g", m))
+							return nil
+						},
+					}
+
+					for _, want := range []reflect.Type{
+						reflect.TypeFor[string](),
+						reflect.TypeFor[int](),
+						reflect.TypeFor[float64](),
+					} {
+						t, err := ReceiveSwitch(ctx, handlers)
+						if err != nil {
+							return err
+						}
+						if t != want {
+							return fmt.Errorf("unexpected type: got %s, want %s", t, want)
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if want := []string{"string <message>", "int 123", "float64 4.5"}; !slices.Equal(got, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("it calls the handler for an interface that the message implements from ReceiveSwitch", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var got string
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, &reader{Name: "<reader>"})
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[io.Reader](ctx)
+					Ready(ctx)
+
+					t, err := ReceiveSwitch(
+						ctx,
+						map[reflect.Type]func(any) error{
+							reflect.TypeFor[io.Reader](): func(m any) error {
+								got = m.(*reader).Name
+								return nil
+							},
+							reflect.TypeFor[any](): func(m any) error {
+								return fmt.Errorf("unexpected call to the handler for any with %v", m)
+							},
+						},
+					)
+					if err != nil {
+						return err
+					}
+
+					if want := reflect.TypeFor[io.Reader](); t != want {
+						return fmt.Errorf("unexpected type: got %s, want %s", t, want)
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if got != "<reader>" {
+			t.Fatalf("unexpected message: got %q, want %q", got, "<reader>")
+		}
+	})
+
+	t.Run("it returns ErrNoHandler from ReceiveSwitch if there is no handler for the message", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, 123)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					t, err := ReceiveSwitch(
+						ctx,
+						map[reflect.Type]func(any) error{
+							reflect.TypeFor[string](): func(any) error {
+								return errors.New("unexpected call to the handler for string")
+							},
+						},
+					)
+
+					if want := reflect.TypeFor[int](); t != want {
+						return fmt.Errorf("unexpected type: got %s, want %s", t, want)
+					}
+
+					return err
+				},
+			),
+		)
+		if !errors.Is(err, ErrNoHandler) {
+			t.Fatalf("unexpected error: got %v, want %v", err, ErrNoHandler)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package minibus
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand/v2"
+)
+
+// SendSharded sends a message to the other functions executed by the same call
+// to [Run], delivering it to the member of each group that is assigned to key.
+//
+// A group is a set of functions that compete for messages, as per [WithGroup].
+// Send delivers each message to a single member of each group, chosen at
+// random. SendSharded instead assigns each key to one member of each group,
+// so that all messages with the same key are delivered to the same member.
+// This allows the members to process disjoint partitions of stateful work.
+// Subscribers that are not in a group receive the message as usual.
+//
+// Keys are assigned using rendezvous hashing over the names of the members
+// that subscribe to the message's type. When a member returns, stops or
+// unsubscribes, only the keys that were assigned to it are reassigned to the
+// remaining members; the keys assigned to the others are unaffected. Likewise,
+// a new member only takes over a share of the keys from the existing members.
+// A message that is already being delivered to a member when it returns is
+// dropped.
+func SendSharded(ctx context.Context, key string, m any) error {
+	env := envelopeOf(m)
+	env.ShardKey = key
+	env.IsSharded = true
+	return Send(ctx, env)
+}
+
+// selectGroupMembers returns the recipients of env that remain once a single
+// member of each group has been selected, as per [WithGroup]. If fair is true,
+// members are selected as per [WithFairDelivery].
+//
+// Members that have returned or stopped are never selected. If every member of
+// a group has returned, the message is not delivered to that group.
+func selectGroupMembers(env envelope, recipients []*function, fair bool) []*function {
+	var groups map[string][]*function
+
+	selected := recipients[:0]
+	for _, sub := range recipients {
+		if sub.Group == "" {
+			selected = append(selected, sub)
+		} else if !sub.isFinished() {
+			if groups == nil {
+				groups = map[string][]*function{}
+			}
+			groups[sub.Group] = append(groups[sub.Group], sub)
+		}
+	}
+
+	for _, members := range groups {
+		selected = append(selected, selectMember(env, members, fair))
+	}
+
+	return selected
+}
+
+// selectMember returns the member of a group that receives env.
+func selectMember(env envelope, members []*function, fair bool) *function {
+	if env.IsSharded {
+		return selectShard(env.ShardKey, members)
+	}
+
+	if !fair {
+		return members[rand.IntN(len(members))]
+	}
+
+	// Select the member that has been selected the fewest times, preferring
+	// those that were added to [Run] first, so that the messages are shared
+	// evenly regardless of the order in which the members are found.
+	member := members[0]
+	for _, sub := range members[1:] {
+		n, fewest := sub.Selected.Load(), member.Selected.Load()
+		if n < fewest || (n == fewest && sub.Index < member.Index) {
+			member = sub
+		}
+	}
+
+	member.Selected.Add(1)
+
+	return member
+}
+
+// selectShard returns the member of a group that is assigned to key, using
+// rendezvous hashing.
+func selectShard(key string, members []*function) *function {
+	var (
+		member *function
+		best   uint64
+	)
+
+	for _, sub := range members {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(sub.Name))
+
+		if score := h.Sum64(); member == nil || score > best {
+			member, best = sub, score
+		}
+	}
+
+	return member
+}
@@ -0,0 +1,310 @@
+package minibus_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+// groupDelivery is a message that reports that a group member received a
+// message.
+type groupDelivery struct {
+	Member string
+	Key    string
+	Value  int
+}
+
+// groupMember returns a function that subscribes to int messages and reports
+// each one it receives, until done is closed.
+func groupMember(done <-chan struct{}) Func {
+	return func(ctx context.Context) error {
+		Subscribe[int](ctx)
+		Ready(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-done:
+				return nil
+			case m := <-Inbox(ctx):
+				v := m.(int)
+				d := groupDelivery{Name(ctx), fmt.Sprint(v % 5), v}
+				if err := Send(ctx, d); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func TestWithGroup(t *testing.T) {
+	t.Run("it delivers each message to a single member of the group", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		done := make(chan struct{})
+		members := map[string]int{}
+		observed := 0
+
+		err := Run(
+			ctx,
+			Fork(3, groupMember(done), WithGroup("<group>")),
+			WithFunc(
+				func(ctx context.Context) error {
+					defer close(done)
+
+					Subscribe[groupDelivery](ctx)
+					Ready(ctx)
+
+					seen := map[int]bool{}
+					for len(seen) < 30 {
+						d, err := ReceiveAs[groupDelivery](ctx)
+						if err != nil {
+							return err
+						}
+						if seen[d.Value] {
+							return fmt.Errorf("message %d was delivered more than once", d.Value)
+						}
+						seen[d.Value] = true
+						members[d.Member]++
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					// Subscribers that are not in a group receive every message.
+					for observed < 30 {
+						if _, err := ReceiveAs[int](ctx); err != nil {
+							return err
+						}
+						observed++
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for v := range 30 {
+						if err := Send(ctx, v); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if len(members) < 2 {
+			t.Fatalf("expected messages to be distributed between members, got %v", members)
+		}
+	})
+
+	t.Run("it shares messages evenly between members when fair delivery is enabled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		done := make(chan struct{})
+		members := map[string]int{}
+
+		err := Run(
+			ctx,
+			WithFairDelivery(),
+			Fork(3, groupMember(done), WithGroup("<group>")),
+			WithFunc(
+				func(ctx context.Context) error {
+					defer close(done)
+
+					Subscribe[groupDelivery](ctx)
+					Ready(ctx)
+
+					for range 300 {
+						d, err := ReceiveAs[groupDelivery](ctx)
+						if err != nil {
+							return err
+						}
+						members[d.Member]++
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for v := range 300 {
+						if err := Send(ctx, v); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if len(members) != 3 {
+			t.Fatalf("expected messages to be delivered to all 3 members, got %v", members)
+		}
+
+		for m, n := range members {
+			if n < 95 || n > 105 {
+				t.Fatalf("member %q received %d messages, want 100 (±5)", m, n)
+			}
+		}
+	})
+
+	t.Run("it panics if the name is empty", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic")
+			}
+		}()
+
+		WithGroup("")
+	})
+}
+
+func TestSendSharded(t *testing.T) {
+	t.Run("it delivers messages with the same key to the same member", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		done := make(chan struct{})
+		shards := map[string]string{}
+
+		err := Run(
+			ctx,
+			Fork(3, groupMember(done), WithGroup("<group>")),
+			WithFunc(
+				func(ctx context.Context) error {
+					defer close(done)
+
+					Subscribe[groupDelivery](ctx)
+					Ready(ctx)
+
+					for range 30 {
+						d, err := ReceiveAs[groupDelivery](ctx)
+						if err != nil {
+							return err
+						}
+
+						if m, ok := shards[d.Key]; !ok {
+							shards[d.Key] = d.Member
+						} else if m != d.Member {
+							return fmt.Errorf("key %q was delivered to both %q and %q", d.Key, m, d.Member)
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for v := range 30 {
+						if err := SendSharded(ctx, fmt.Sprint(v%5), v); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it reassigns the keys of a member that stops", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+
+		err := Run(
+			ctx,
+			Fork(
+				2,
+				func(ctx context.Context) error {
+					if strings.HasSuffix(Name(ctx), "#0") {
+						Subscribe[int](ctx)
+						Ready(ctx)
+						Stop(ctx)
+						close(stopped)
+						return nil
+					}
+
+					return groupMember(done)(ctx)
+				},
+				WithGroup("<group>"),
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					defer close(done)
+
+					Subscribe[groupDelivery](ctx)
+					Ready(ctx)
+
+					for range 10 {
+						d, err := ReceiveAs[groupDelivery](ctx)
+						if err != nil {
+							return err
+						}
+
+						if !strings.HasSuffix(d.Member, "#1") {
+							return fmt.Errorf("unexpected member: %q", d.Member)
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-stopped:
+					}
+
+					for v := range 10 {
+						if err := SendSharded(ctx, fmt.Sprint(v), v); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package minibus
+
+import "context"
+
+// Handle is an opaque reference to a function executed by [Run].
+//
+// Handles are comparable, and may be used as map keys. The zero value does not
+// refer to any function.
+type Handle struct {
+	f *function
+}
+
+// Sender returns a handle to the function that sent the message most recently
+// received by the calling function.
+//
+// It returns false if the calling function has not received any messages.
+//
+// It may only be called within a function that has been called by [Run].
+func Sender(ctx context.Context) (Handle, bool) {
+	env, ok := caller(ctx).Received()
+	if !ok {
+		return Handle{}, false
+	}
+	return Handle{env.Sender}, true
+}
+
+// SendTo sends a message to a single function, or returns an error if ctx is
+// canceled.
+//
+// The message is only delivered if the function identified by h subscribes to
+// the message's type; otherwise it is discarded, just as a message sent using
+// [Send] is discarded when it has no subscribers. A function does not receive
+// the messages it sends itself, unless it uses the [WithSelfDelivery] option.
+//
+// It panics if h is the zero value.
+func SendTo(ctx context.Context, h Handle, m any) error {
+	if h.f == nil {
+		panic("minibus: SendTo() must not be called with a zero-value handle")
+	}
+
+	env := envelopeOf(m)
+	env.Recipient = h.f
+
+	return Send(ctx, env)
+}
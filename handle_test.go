@@ -0,0 +1,150 @@
+package minibus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestSendTo(t *testing.T) {
+	t.Run("it only delivers messages sent with SendTo to the targeted function", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		// target sends a request to the coordinator and expects to receive a
+		// reply addressed to it, followed by the broadcast message.
+		target := func(ctx context.Context) error {
+			Subscribe[int](ctx)
+			Ready(ctx)
+
+			if err := Send(ctx, "<request>"); err != nil {
+				return err
+			}
+
+			for _, want := range []int{42, 7} {
+				m, err := ReceiveAs[int](ctx)
+				if err != nil {
+					return err
+				}
+				if m != want {
+					return fmt.Errorf("target received unexpected message: got %d, want %d", m, want)
+				}
+			}
+
+			return nil
+		}
+
+		// bystander only expects to receive the broadcast message.
+		bystander := func(ctx context.Context) error {
+			Subscribe[int](ctx)
+			Ready(ctx)
+
+			m, err := ReceiveAs[int](ctx)
+			if err != nil {
+				return err
+			}
+			if m != 7 {
+				return fmt.Errorf("bystander received unexpected message: got %d, want 7", m)
+			}
+
+			return nil
+		}
+
+		coordinator := func(ctx context.Context) error {
+			Subscribe[string](ctx)
+			Ready(ctx)
+
+			if _, err := Receive(ctx); err != nil {
+				return err
+			}
+
+			h, ok := Sender(ctx)
+			if !ok {
+				return errors.New("Sender() did not return a handle")
+			}
+
+			if err := SendTo(ctx, h, 42); err != nil {
+				return err
+			}
+
+			return Send(ctx, 7)
+		}
+
+		err := Run(
+			ctx,
+			WithFunc(target),
+			WithFunc(bystander),
+			WithFunc(coordinator),
+		)
+
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+}
+
+func TestSender(t *testing.T) {
+	t.Run("it reports the sender of the message most recently read from Inbox", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		// sender sends m and expects the receiver to acknowledge it by
+		// replying to the sender of the message.
+		sender := func(m int) Func {
+			return func(ctx context.Context) error {
+				Subscribe[string](ctx)
+				Ready(ctx)
+
+				if err := Send(ctx, m); err != nil {
+					return err
+				}
+
+				ack, err := ReceiveAs[string](ctx)
+				if err != nil {
+					return err
+				}
+				if want := fmt.Sprint(m); ack != want {
+					return fmt.Errorf("unexpected acknowledgement: got %q, want %q", ack, want)
+				}
+
+				return nil
+			}
+		}
+
+		err := Run(
+			ctx,
+			WithFunc(sender(1)),
+			WithFunc(sender(2)),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					inbox := Inbox(ctx)
+
+					for range 2 {
+						m := <-inbox
+
+						h, ok := Sender(ctx)
+						if !ok {
+							return errors.New("Sender() did not return a handle")
+						}
+
+						if err := SendTo(ctx, h, fmt.Sprint(m)); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package minibus
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SubscribeHandlers subscribes the calling function to the message types
+// accepted by the handlers of h, and returns a function that dispatches the
+// messages in the inbox to those handlers.
+//
+// A handler method is any method of h with a name that begins with "Handle" and
+// the signature:
+//
+//	func(context.Context, M) error
+//
+// where M is the message type. For example:
+//
+//	func (h *Handlers) HandleSayHello(ctx context.Context, m SayHello) error
+//
+// Methods that begin with "Handle" but do not have this signature are not
+// handlers, and are ignored.
+//
+// If h is a struct, or a pointer to a struct, any field tagged with
+// `minibus:"subscribe"` is also a handler. The field must be exported, and be a
+// non-nil function with the same signature. For example:
+//
+//	type Handlers struct {
+//		OnSayHello func(context.Context, SayHello) error `minibus:"subscribe"`
+//	}
+//
+// Each message is dispatched to the handler for its concrete type, if there is
+// one. Otherwise, it is dispatched to the first handler that accepts an
+// interface that the message implements, with methods (in lexical order of
+// method name) taking precedence over fields (in declaration order).
+//
+// The returned function blocks until a handler returns a non-nil error, which
+// it returns, or ctx is canceled.
+//
+// It panics if h has no handlers, if a tagged field is unexported, nil or does
+// not have the handler signature, or if two handlers handle the same message
+// type.
+//
+// It may only be called within a function that has been called by [Run]. It
+// must be called before [Ready].
+func SubscribeHandlers(ctx context.Context, h any) func(context.Context) error {
+	f := caller(ctx)
+	if f.ReadySignal == nil {
+		panic("minibus: SubscribeHandlers() must not be called after calling Ready()")
+	}
+
+	d := newDispatcher(h)
+
+	for _, t := range d.Types {
+		f.Subscribe(ctx, t, nil)
+	}
+
+	return d.Run
+}
+
+var (
+	contextType = reflect.TypeFor[context.Context]()
+	errorType   = reflect.TypeFor[error]()
+)
+
+// handlerFunc is a function that handles a message.
+type handlerFunc func(context.Context, any) error
+
+// dispatcher dispatches messages to handlers based on their type.
+type dispatcher struct {
+	Types    []reflect.Type
+	Handlers map[reflect.Type]handlerFunc
+
+	// Default is the handler for messages that do not match any of the types
+	// in Types. If it is nil such messages are ignored.
+	Default handlerFunc
+}
+
+func newDispatcher(h any) *dispatcher {
+	v := reflect.ValueOf(h)
+	if !v.IsValid() {
+		panic("minibus: handler must not be nil")
+	}
+
+	d := &dispatcher{}
+
+	for i := range v.NumMethod() {
+		m := v.Type().Method(i)
+		if !strings.HasPrefix(m.Name, "Handle") {
+			continue
+		}
+
+		// The method type includes the receiver, so we check the method
+		// value's type instead.
+		method := v.Method(i)
+		if t, ok := handlerType(method.Type()); ok {
+			d.Add(t, handlerOf(method))
+		}
+	}
+
+	s := reflect.Indirect(v)
+	if s.Kind() == reflect.Struct {
+		for i := range s.NumField() {
+			field := s.Type().Field(i)
+			if field.Tag.Get("minibus") != "subscribe" {
+				continue
+			}
+
+			fn := s.Field(i)
+			t, ok := handlerType(field.Type)
+			if !ok || !field.IsExported() || fn.IsNil() {
+				panic(fmt.Sprintf(
+					"minibus: %s.%s must be an exported, non-nil func(context.Context, M) error",
+					s.Type(),
+					field.Name,
+				))
+			}
+
+			d.Add(t, handlerOf(fn))
+		}
+	}
+
+	if len(d.Types) == 0 {
+		panic(fmt.Sprintf("minibus: %s has no handlers", v.Type()))
+	}
+
+	return d
+}
+
+// handlerType returns the message type accepted by a function of type t, if t
+// has the signature func(context.Context, M) error.
+func handlerType(t reflect.Type) (reflect.Type, bool) {
+	if t.Kind() != reflect.Func ||
+		t.NumIn() != 2 ||
+		t.In(0) != contextType ||
+		t.NumOut() != 1 ||
+		t.Out(0) != errorType {
+		return nil, false
+	}
+	return t.In(1), true
+}
+
+// handlerOf returns a [handlerFunc] that calls fn, which must be a function
+// with the signature func(context.Context, M) error.
+func handlerOf(fn reflect.Value) handlerFunc {
+	return func(ctx context.Context, m any) error {
+		out := fn.Call([]reflect.Value{
+			reflect.ValueOf(ctx),
+			reflect.ValueOf(m),
+		})
+		err, _ := out[0].Interface().(error)
+		return err
+	}
+}
+
+// Add adds a handler for messages of type t.
+func (d *dispatcher) Add(t reflect.Type, h handlerFunc) {
+	if _, ok := d.Handlers[t]; ok {
+		panic(fmt.Sprintf("minibus: more than one handler for %s", t))
+	}
+
+	if d.Handlers == nil {
+		d.Handlers = map[reflect.Type]handlerFunc{}
+	}
+
+	d.Types = append(d.Types, t)
+	d.Handlers[t] = h
+}
+
+// Run dispatches messages from the inbox until a handler returns an error or
+// ctx is canceled.
+func (d *dispatcher) Run(ctx context.Context) error {
+	for {
+		m, err := Receive(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := d.Dispatch(ctx, m); err != nil {
+			return err
+		}
+	}
+}
+
+// Dispatch invokes the handler for m, if any.
+func (d *dispatcher) Dispatch(ctx context.Context, m any) error {
+	if _, h := d.handlerFor(reflect.TypeOf(m)); h != nil {
+		return caller(ctx).Handle(ctx, m, h)
+	}
+	return nil
+}
+
+// handlerFor returns the handler for messages of type t, and the type that it
+// was registered for, which may be an interface that t implements. It returns
+// a nil handler if there is none.
+func (d *dispatcher) handlerFor(t reflect.Type) (reflect.Type, handlerFunc) {
+	if t == nil {
+		return anyType, d.Default
+	}
+
+	if h, ok := d.Handlers[t]; ok {
+		return t, h
+	}
+
+	for _, ht := range d.Types {
+		if ht.Kind() == reflect.Interface && t.Implements(ht) {
+			return ht, d.Handlers[ht]
+		}
+	}
+
+	return anyType, d.Default
+}
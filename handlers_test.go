@@ -0,0 +1,197 @@
+package minibus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+type handlers struct {
+	Strings []string
+	Ints    []int
+	Err     error
+}
+
+func (h *handlers) HandleString(_ context.Context, m string) error {
+	h.Strings = append(h.Strings, m)
+	return nil
+}
+
+func (h *handlers) HandleInt(_ context.Context, m int) error {
+	h.Ints = append(h.Ints, m)
+	return h.Err
+}
+
+// HandleCount is not a handler, because it does not have the handler
+// signature.
+func (h *handlers) HandleCount() int {
+	return len(h.Strings) + len(h.Ints)
+}
+
+type taggedHandlers struct {
+	OnString func(context.Context, string) error `minibus:"subscribe"`
+	OnInt    func(context.Context, int) error    `minibus:"subscribe"`
+	Untagged func(context.Context, bool) error
+}
+
+type badHandlers struct{}
+
+func (badHandlers) HandleString(m string) {}
+
+type badTaggedHandlers struct {
+	OnString func(string) `minibus:"subscribe"`
+}
+
+func TestSubscribeHandlers(t *testing.T) {
+	t.Run("it subscribes to and dispatches each handled message type", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		h := &handlers{
+			Err: errors.New("<done>"),
+		}
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					dispatch := SubscribeHandlers(ctx, h)
+					Ready(ctx)
+					return dispatch(ctx)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := Send(ctx, "<message>"); err != nil {
+						return err
+					}
+
+					return Send(ctx, 42)
+				},
+			),
+		)
+
+		if err != h.Err {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, h.Err)
+		}
+
+		if fmt.Sprint(h.Strings) != "[<message>]" {
+			t.Fatalf("unexpected strings: %v", h.Strings)
+		}
+
+		if fmt.Sprint(h.Ints) != "[42]" {
+			t.Fatalf("unexpected ints: %v", h.Ints)
+		}
+	})
+
+	t.Run("it subscribes to and dispatches to tagged fields", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received []any
+		done := errors.New("<done>")
+
+		h := taggedHandlers{
+			OnString: func(_ context.Context, m string) error {
+				received = append(received, m)
+				return nil
+			},
+			OnInt: func(_ context.Context, m int) error {
+				received = append(received, m)
+				return done
+			},
+		}
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					dispatch := SubscribeHandlers(ctx, h)
+					Ready(ctx)
+					return dispatch(ctx)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					// The untagged field's message type is not subscribed to,
+					// so this message is not delivered.
+					if err := Send(ctx, true); err != nil {
+						return err
+					}
+
+					if err := Send(ctx, "<message>"); err != nil {
+						return err
+					}
+
+					return Send(ctx, 42)
+				},
+			),
+		)
+
+		if err != done {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, done)
+		}
+
+		if fmt.Sprint(received) != "[<message> 42]" {
+			t.Fatalf("unexpected messages: %v", received)
+		}
+	})
+
+	t.Run("it panics if there are no handlers", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var recovered any
+
+		Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					defer func() {
+						recovered = recover()
+					}()
+
+					SubscribeHandlers(ctx, badHandlers{})
+					return nil
+				},
+			),
+		)
+
+		if recovered == nil {
+			t.Fatal("expected a panic")
+		}
+	})
+
+	t.Run("it panics if a tagged field has the wrong signature", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var recovered any
+
+		Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					defer func() {
+						recovered = recover()
+					}()
+
+					SubscribeHandlers(ctx, badTaggedHandlers{func(string) {}})
+					return nil
+				},
+			),
+		)
+
+		if recovered == nil {
+			t.Fatal("expected a panic")
+		}
+	})
+}
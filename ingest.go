@@ -0,0 +1,210 @@
+package minibus
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// Ingest returns a [Func] that sends each value received from messages to the
+// other functions executed by the same call to [Run].
+//
+// The function returns when messages is closed or ctx is canceled. Once ctx is
+// canceled no more values are received from messages, so any values that are
+// yet to be received remain in the channel. A value that was received just
+// before ctx is canceled may still fail to be sent, in which case it's lost.
+func Ingest[T any](messages <-chan T) Func {
+	return func(ctx context.Context) error {
+		Ready(ctx)
+
+		for {
+			m, ok, err := ingest(ctx, messages)
+			if !ok {
+				return err
+			}
+			if err := Send(ctx, m); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ingest receives the next value from messages on behalf of one of the Ingest
+// functions. ok is false if messages is closed or ctx is canceled, in which
+// case err is the context's error, if any.
+//
+// ctx is checked before messages, so that a value is never received once it
+// can no longer be sent, even if messages also has a value ready.
+func ingest[T any](ctx context.Context, messages <-chan T) (m T, ok bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return m, false, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return m, false, ctx.Err()
+	case m, ok = <-messages:
+		return m, ok, nil
+	}
+}
+
+// IngestMany returns a [Func] that sends each value received from any of the
+// given channels to the other functions executed by the same call to [Run].
+//
+// It is useful for adapters that receive from several sources, such as a set
+// of network connections. Values from each channel are sent in the order they
+// are received, but there is no ordering between the channels.
+//
+// The function returns when all of the channels are closed or ctx is canceled.
+// As with [Ingest], no more values are received once ctx is canceled.
+func IngestMany[T any](channels ...<-chan T) Func {
+	return func(ctx context.Context) error {
+		Ready(ctx)
+
+		// The first case is always the context, followed by one case for each
+		// channel. Each channel's case is disabled once the channel is closed
+		// by setting it to the zero value, which reflect.Select ignores.
+		cases := make([]reflect.SelectCase, 0, len(channels)+1)
+		cases = append(
+			cases,
+			reflect.SelectCase{
+				Dir:  reflect.SelectRecv,
+				Chan: reflect.ValueOf(ctx.Done()),
+			},
+		)
+
+		for _, ch := range channels {
+			cases = append(
+				cases,
+				reflect.SelectCase{
+					Dir:  reflect.SelectRecv,
+					Chan: reflect.ValueOf(ch),
+				},
+			)
+		}
+
+		for open := len(channels); open > 0; {
+			// As per ingest(), the context is checked first so that a value
+			// is never received once it can no longer be sent.
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			i, v, ok := reflect.Select(cases)
+
+			if i == 0 {
+				return ctx.Err()
+			}
+
+			if !ok {
+				cases[i].Chan = reflect.Value{}
+				open--
+				continue
+			}
+
+			// The assertion fails only if T is an interface type and the value
+			// is nil, in which case m is the nil value that was received.
+			m, _ := v.Interface().(T)
+
+			if err := Send(ctx, m); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// IngestMap returns a [Func] that applies fn to each value received from
+// messages, and sends the result to the other functions executed by the same
+// call to [Run].
+//
+// It is useful for converting values from an external source into the message
+// types used within the session.
+//
+// The function returns when messages is closed or ctx is canceled.
+// As with [Ingest], no more values are received once ctx is canceled.
+func IngestMap[T, U any](messages <-chan T, fn func(T) U) Func {
+	if fn == nil {
+		panic("minibus: IngestMap() must not be called with a nil function")
+	}
+
+	return func(ctx context.Context) error {
+		Ready(ctx)
+
+		for {
+			m, ok, err := ingest(ctx, messages)
+			if !ok {
+				return err
+			}
+			if err := Send(ctx, fn(m)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Once returns a [Func] that sends m to the other functions executed by the
+// same call to [Run], then returns.
+//
+// It is the single-message counterpart to [Ingest], and is useful for seeding
+// a session with an initial message.
+func Once[T any](m T) Func {
+	return func(ctx context.Context) error {
+		Ready(ctx)
+		return Send(ctx, m)
+	}
+}
+
+// IngestPaced returns a [Func] that sends each value received from messages to
+// the other functions executed by the same call to [Run], leaving at least
+// interval between consecutive sends.
+//
+// It is useful for simulating a real-time source of messages. A message is sent
+// as soon as it is received if at least interval has elapsed since the previous
+// message was sent, so pauses in the arrival of messages are not followed by a
+// burst. The time is obtained from the [Clock] given by [WithClock], if any.
+//
+// The function returns when messages is closed or ctx is canceled.
+// As with [Ingest], no more values are received once ctx is canceled.
+//
+// It panics if interval is not positive.
+func IngestPaced[T any](messages <-chan T, interval time.Duration) Func {
+	if interval <= 0 {
+		panic("minibus: IngestPaced() must be called with a positive interval")
+	}
+
+	return func(ctx context.Context) error {
+		clock := caller(ctx).Config.Clock
+
+		Ready(ctx)
+
+		var (
+			last time.Time
+			sent bool
+		)
+
+		for {
+			m, ok, err := ingest(ctx, messages)
+			if !ok {
+				return err
+			}
+
+			if sent {
+				if wait := interval - clock.Now().Sub(last); wait > 0 {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-clock.After(wait):
+					}
+				}
+			}
+
+			last, sent = clock.Now(), true
+
+			if err := Send(ctx, m); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package minibus_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestIngest(t *testing.T) {
+	t.Run("it sends each value from the channel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		messages := make(chan string, 3)
+		messages <- "<one>"
+		messages <- "<two>"
+		messages <- "<three>"
+		close(messages)
+
+		var received []string
+
+		err := Run(
+			ctx,
+			WithFunc(Ingest(messages)),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					for len(received) < 3 {
+						m, err := Receive(ctx)
+						if err != nil {
+							return err
+						}
+						received = append(received, m.(string))
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if want := []string{"<one>", "<two>", "<three>"}; !slices.Equal(received, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", received, want)
+		}
+	})
+
+	t.Run("it does not receive from the channel once the context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		messages := make(chan string, 1)
+		messages <- "<message>"
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					ctx, cancel := context.WithCancel(ctx)
+					cancel()
+
+					// Both the context and the channel are ready, so without
+					// checking the context first, the value would be received
+					// half of the time.
+					for range 100 {
+						if err := Ingest(messages)(ctx); err != context.Canceled {
+							return fmt.Errorf("unexpected error: got %v, want %q", err, context.Canceled)
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if len(messages) != 1 {
+			t.Fatal("expected the message to remain in the channel")
+		}
+	})
+}
+
+func TestIngestMany(t *testing.T) {
+	t.Run("it sends each value from all of the channels", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var channels []<-chan string
+		var want []string
+
+		for _, source := range []string{"a", "b", "c"} {
+			messages := make(chan string, 3)
+			for i := range cap(messages) {
+				m := fmt.Sprintf("<%s%d>", source, i)
+				messages <- m
+				want = append(want, m)
+			}
+			close(messages)
+
+			channels = append(channels, messages)
+		}
+
+		var received []string
+
+		err := Run(
+			ctx,
+			WithFunc(IngestMany(channels...)),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					for len(received) < len(want) {
+						m, err := Receive(ctx)
+						if err != nil {
+							return err
+						}
+						received = append(received, m.(string))
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		slices.Sort(received)
+
+		if !slices.Equal(received, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", received, want)
+		}
+	})
+
+	t.Run("it returns once all of the channels are closed", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		a := make(chan int)
+		b := make(chan int)
+		close(a)
+		close(b)
+
+		if err := Run(ctx, WithFunc(IngestMany[int](a, b))); err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+}
+
+func TestIngestMap(t *testing.T) {
+	t.Run("it sends the result of the mapping function for each value from the channel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		type wrapper struct {
+			Value int
+		}
+
+		messages := make(chan int, 3)
+		messages <- 1
+		messages <- 2
+		messages <- 3
+		close(messages)
+
+		var received []wrapper
+
+		err := Run(
+			ctx,
+			WithFunc(
+				IngestMap(
+					messages,
+					func(v int) wrapper {
+						return wrapper{v * 10}
+					},
+				),
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[wrapper](ctx)
+					Ready(ctx)
+
+					for len(received) < 3 {
+						m, err := ReceiveAs[wrapper](ctx)
+						if err != nil {
+							return err
+						}
+						received = append(received, m)
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if want := []wrapper{{10}, {20}, {30}}; !slices.Equal(received, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", received, want)
+		}
+	})
+}
+
+func TestOnce(t *testing.T) {
+	t.Run("it sends the message", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received string
+
+		err := Run(
+			ctx,
+			WithFunc(Once("<seed>")),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					var err error
+					received, err = ReceiveAs[string](ctx)
+					return err
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if received != "<seed>" {
+			t.Fatalf("unexpected message: got %q, want %q", received, "<seed>")
+		}
+	})
+}
+
+func TestIngestPaced(t *testing.T) {
+	t.Run("it leaves at least the interval between consecutive messages", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const interval = 20 * time.Millisecond
+
+		clock := newManualClock()
+		messages := make(chan int)
+
+		err := Run(
+			ctx,
+			WithClock(clock),
+			WithFunc(IngestPaced(messages, interval)),
+			WithFunc(
+				func(ctx context.Context) error {
+					defer close(messages)
+
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					// expect sends m, then verifies that it's received after
+					// the ingesting function waits for the given duration, if
+					// any.
+					expect := func(m int, wait time.Duration) error {
+						messages <- m
+
+						if wait != 0 {
+							select {
+							case <-ctx.Done():
+								return ctx.Err()
+							case d := <-clock.Waits:
+								if d != wait {
+									return fmt.Errorf("unexpected wait before message %d: got %s, want %s", m, d, wait)
+								}
+							}
+							clock.Advance(wait)
+						}
+
+						got, err := ReceiveAs[int](ctx)
+						if err != nil {
+							return err
+						}
+						if got != m {
+							return fmt.Errorf("unexpected message: got %d, want %d", got, m)
+						}
+
+						return nil
+					}
+
+					// The first message is sent immediately.
+					if err := expect(1, 0); err != nil {
+						return err
+					}
+
+					// A message that arrives straight away waits for the full
+					// interval.
+					if err := expect(2, interval); err != nil {
+						return err
+					}
+
+					// A message that arrives part way through the interval
+					// waits for the remainder.
+					clock.Advance(5 * time.Millisecond)
+					if err := expect(3, interval-5*time.Millisecond); err != nil {
+						return err
+					}
+
+					// A message that arrives after a pause longer than the
+					// interval is sent immediately, and the interval is
+					// measured from that send, not from when the pause began.
+					clock.Advance(3 * interval)
+					if err := expect(4, 0); err != nil {
+						return err
+					}
+					if err := expect(5, interval); err != nil {
+						return err
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it panics if the interval is not positive", func(t *testing.T) {
+		for _, interval := range []time.Duration{0, -1} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Fatalf("expected a panic for an interval of %s", interval)
+					}
+				}()
+
+				IngestPaced(make(chan int), interval)
+			}()
+		}
+	})
+}
+
+// manualClock is a [Clock] that only advances when Advance() is called.
+type manualClock struct {
+	// Waits receives the duration passed to each call to After().
+	Waits chan time.Duration
+
+	m      sync.Mutex
+	now    time.Time
+	timers []manualTimer
+}
+
+type manualTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{
+		Waits: make(chan time.Duration, 1),
+		now:   time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	c.m.Lock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, manualTimer{c.now.Add(d), ch})
+	c.m.Unlock()
+
+	c.Waits <- d
+
+	return ch
+}
+
+// Advance moves the clock forward by d, firing any timers that are due.
+func (c *manualClock) Advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.now = c.now.Add(d)
+
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			t.ch <- c.now
+		}
+	}
+	c.timers = pending
+}
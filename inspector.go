@@ -0,0 +1,96 @@
+package minibus
+
+import (
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// Inspector provides information about the state of a call to [Run] while it's
+// running, as per [WithInspector].
+//
+// It's intended for debugging, such as determining why a message was not
+// delivered.
+type Inspector struct {
+	subs *subscriptions
+
+	m         sync.Mutex
+	functions []*function
+}
+
+// Subscribers returns the number of functions that receive each message type.
+//
+// It includes the types that any function subscribes to directly, and the
+// types of messages that have been sent so far. Types with no subscribers are
+// omitted.
+func (i *Inspector) Subscribers() map[reflect.Type]int {
+	return i.subs.Counts()
+}
+
+// Topology returns the [Topology] of the functions that have been started so
+// far, including those that have since returned.
+func (i *Inspector) Topology() Topology {
+	i.m.Lock()
+	functions := slices.Clone(i.functions)
+	i.m.Unlock()
+
+	return topologyOf(i.subs, functions).Export()
+}
+
+// SubscriptionSnapshot returns the message types that each running function
+// subscribes to directly, keyed by the function's name. Functions that have
+// returned or stopped are omitted.
+//
+// The snapshot can be passed to [WithSubscriptions] to restore the
+// subscriptions in a subsequent call to [Run].
+func (i *Inspector) SubscriptionSnapshot() SubscriptionSnapshot {
+	i.m.Lock()
+	functions := slices.Clone(i.functions)
+	i.m.Unlock()
+
+	snapshot := SubscriptionSnapshot{}
+
+	for _, f := range functions {
+		if f.isFinished() {
+			continue
+		}
+
+		for _, t := range i.subs.Direct(f) {
+			if !slices.Contains(snapshot[f.Name], t) {
+				snapshot[f.Name] = append(snapshot[f.Name], t)
+			}
+		}
+	}
+
+	return snapshot
+}
+
+// SubscriptionSnapshot is the set of message types that each function
+// subscribes to, keyed by the function's name.
+//
+// Functions are identified by name rather than by identity so that the
+// snapshot can be restored against the functions of a different call to
+// [Run].
+type SubscriptionSnapshot map[string][]reflect.Type
+
+// add adds a function that has been started to the inspector.
+func (i *Inspector) add(f *function) {
+	i.m.Lock()
+	i.functions = append(i.functions, f)
+	i.m.Unlock()
+}
+
+// WithInspector is an [Option] that calls inspect with an [Inspector] for the
+// session, before any functions are started.
+//
+// The inspector may be used at any time, including concurrently with the
+// functions, and after [Run] has returned.
+func WithInspector(inspect func(*Inspector)) Option {
+	if inspect == nil {
+		panic("minibus: WithInspector() must not be called with a nil function")
+	}
+
+	return func(cfg *config) {
+		cfg.Inspect = inspect
+	}
+}
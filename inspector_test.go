@@ -0,0 +1,225 @@
+package minibus_test
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestWithInspector(t *testing.T) {
+	t.Run("it reports the number of subscribers for each message type", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var inspector *Inspector
+
+		err := Run(
+			ctx,
+			WithInspector(
+				func(i *Inspector) {
+					inspector = i
+				},
+			),
+			Fork(
+				2,
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					if err := WaitReady(ctx); err != nil {
+						return err
+					}
+
+					got := inspector.Subscribers()
+					want := map[reflect.Type]int{
+						reflect.TypeFor[string](): 3,
+						reflect.TypeFor[int]():    1,
+					}
+
+					if !maps.Equal(got, want) {
+						t.Errorf("unexpected subscriber counts: got %v, want %v", got, want)
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it renders the topology of the session", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var inspector *Inspector
+
+		err := Run(
+			ctx,
+			WithInspector(
+				func(i *Inspector) {
+					inspector = i
+				},
+			),
+			WithNamedFunc(
+				"<producer>",
+				func(ctx context.Context) error {
+					Publish[string](ctx)
+					Ready(ctx)
+					return nil
+				},
+				WithOutputTypes(reflect.TypeFor[int]()),
+			),
+			WithNamedFunc(
+				"<consumer>",
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Subscribe[fmt.Stringer](ctx)
+					Ready(ctx)
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		topology := inspector.Topology()
+
+		wantDOT := `digraph {
+	f0 [label="<producer>"];
+	f1 [label="<consumer>"];
+	f0 -> f1 [label="int"];
+}
+`
+		if got := topology.DOT(); got != wantDOT {
+			t.Fatalf("unexpected DOT output:\ngot:\n%s\nwant:\n%s", got, wantDOT)
+		}
+
+		wantMermaid := `flowchart LR
+	f0["<producer>"]
+	f1["<consumer>"]
+	f0 -->|"int"| f1
+`
+		if got := topology.Mermaid(); got != wantMermaid {
+			t.Fatalf("unexpected Mermaid output:\ngot:\n%s\nwant:\n%s", got, wantMermaid)
+		}
+	})
+
+	t.Run("it restores a snapshot of the subscriptions in a subsequent session", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var (
+			inspector *Inspector
+			snapshot  SubscriptionSnapshot
+		)
+		taken := make(chan struct{})
+
+		err := Run(
+			ctx,
+			WithInspector(
+				func(i *Inspector) {
+					inspector = i
+				},
+			),
+			WithNamedFunc(
+				"<consumer>",
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Subscribe[int](ctx)
+					Ready(ctx)
+					<-taken
+					return nil
+				},
+			),
+			WithNamedFunc(
+				"<returned>",
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+					return nil
+				},
+			),
+			WithNamedFunc(
+				"<snapshot>",
+				func(ctx context.Context) error {
+					Ready(ctx)
+					defer close(taken)
+
+					if err := WaitReady(ctx); err != nil {
+						return err
+					}
+
+					// Wait for the function that returns to be omitted from
+					// the snapshot, as it's only removed once it has returned.
+					for {
+						snapshot = inspector.SubscriptionSnapshot()
+						if _, ok := snapshot["<returned>"]; !ok {
+							return nil
+						}
+
+						select {
+						case <-ctx.Done():
+							return ctx.Err()
+						case <-time.After(1 * time.Millisecond):
+						}
+					}
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		want := SubscriptionSnapshot{
+			"<consumer>": {
+				reflect.TypeFor[int](),
+				reflect.TypeFor[string](),
+			},
+		}
+
+		if !reflect.DeepEqual(snapshot, want) {
+			t.Fatalf("unexpected snapshot: got %v, want %v", snapshot, want)
+		}
+
+		var received any
+
+		err = Run(
+			ctx,
+			WithSubscriptions(snapshot),
+			WithNamedFunc(
+				"<consumer>",
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					m, err := Receive(ctx)
+					received = m
+					return err
+				},
+			),
+			WithFunc(Once("<message>")),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if received != "<message>" {
+			t.Fatalf("unexpected message: got %v, want %q", received, "<message>")
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package minibus
+
+import (
+	"context"
+	"log/slog"
+	"runtime/trace"
+	"strings"
+)
+
+// levelVerbose is the level at which fine-grained events, such as changes to
+// a function's subscriptions, are logged.
+const levelVerbose = slog.LevelDebug - 4
+
+// log records an event that occurred within f to the runtime/trace log and,
+// if configured, f's logger.
+func (f *function) log(ctx context.Context, event string, attrs ...slog.Attr) {
+	f.logAt(ctx, slog.LevelDebug, event, attrs...)
+}
+
+// verbose records a fine-grained event that occurred within f, such that it's
+// only logged when the configured level permits it.
+func (f *function) verbose(ctx context.Context, event string, attrs ...slog.Attr) {
+	f.logAt(ctx, levelVerbose, event, attrs...)
+}
+
+// warn records an event that occurred within f that may indicate a problem,
+// such that it's logged at the warning level.
+func (f *function) warn(ctx context.Context, event string, attrs ...slog.Attr) {
+	f.logAt(ctx, slog.LevelWarn, event, attrs...)
+}
+
+// logAt records an event that occurred within f at the given level.
+func (f *function) logAt(ctx context.Context, level slog.Level, event string, attrs ...slog.Attr) {
+	if level < f.Config.LogLevel {
+		return
+	}
+
+	if trace.IsEnabled() {
+		var w strings.Builder
+
+		w.WriteString(f.Name)
+		w.WriteString(": ")
+		w.WriteString(event)
+
+		for _, attr := range attrs {
+			w.WriteByte(' ')
+			w.WriteString(attr.String())
+		}
+
+		trace.Log(ctx, "minibus", w.String())
+	}
+
+	if f.Config.Logger != nil {
+		f.Config.Logger.LogAttrs(
+			ctx,
+			level,
+			event,
+			append(
+				[]slog.Attr{slog.String("function", f.Name)},
+				attrs...,
+			)...,
+		)
+	}
+}
@@ -4,13 +4,56 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/dogmatiq/minibus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
+// deliveryCounter is a [sdktrace.SpanProcessor] that records the maximum number
+// of messages that are being delivered concurrently.
+type deliveryCounter struct {
+	active atomic.Int64
+	max    atomic.Int64
+}
+
+func (c *deliveryCounter) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	if strings.HasPrefix(s.Name(), "minibus.deliver ") {
+		n := c.active.Add(1)
+		for {
+			m := c.max.Load()
+			if n <= m || c.max.CompareAndSwap(m, n) {
+				break
+			}
+		}
+	}
+}
+
+func (c *deliveryCounter) OnEnd(s sdktrace.ReadOnlySpan) {
+	if strings.HasPrefix(s.Name(), "minibus.deliver ") {
+		c.active.Add(-1)
+	}
+}
+
+func (*deliveryCounter) Shutdown(context.Context) error   { return nil }
+func (*deliveryCounter) ForceFlush(context.Context) error { return nil }
+
+// reader is an [io.Reader] used to test routing by interface type.
+type reader struct {
+	Name string
+}
+
+func (*reader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
 func TestRun_messaging(t *testing.T) {
 	t.Run("it does not exchange any messages until all functions are ready", func(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
@@ -20,74 +63,1259 @@ func TestRun_messaging(t *testing.T) {
 
 		err := Run(
 			ctx,
-			func(ctx context.Context) error {
-				// Delay a little to help induce the race condition we're
-				// testing for.
-				time.Sleep(10 * time.Millisecond)
+			WithFunc(
+				func(ctx context.Context) error {
+					// Delay a little to help induce the race condition we're
+					// testing for.
+					time.Sleep(10 * time.Millisecond)
 
-				Subscribe[string](ctx)
+					Subscribe[string](ctx)
 
-				started.Add(1)
-				Ready(ctx)
+					started.Add(1)
+					Ready(ctx)
+
+					m, err := Receive(ctx)
+					if err != nil {
+						return err
+					}
+
+					if started.Load() != 2 {
+						return fmt.Errorf("received a message before all signaled readiness: %q", m)
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					started.Add(1)
+					Ready(ctx)
+
+					if err := Send(ctx, "<message>"); err != nil {
+						return err
+					}
+
+					if started.Load() != 2 {
+						return fmt.Errorf("sent a message before all functions signaled readiness")
+					}
+
+					return nil
+				},
+			),
+		)
+
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it does not deliver messages to the function that sent them", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					err := Send(ctx, "<message>")
+					if err != nil {
+						return err
+					}
+
+					select {
+					case <-time.After(50 * time.Millisecond):
+						return nil
+					case <-Inbox(ctx):
+						return errors.New("function received a message from itself")
+					}
+				},
+			),
+		)
+
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it delivers every message sent concurrently from multiple goroutines", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		type message struct {
+			Goroutine, Seq int
+		}
+
+		const (
+			goroutines = 10
+			perRoutine = 100
+		)
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[message](ctx)
+					Ready(ctx)
+
+					received := map[message]struct{}{}
+
+					for len(received) < goroutines*perRoutine {
+						m, err := Receive(ctx)
+						if err != nil {
+							return err
+						}
+
+						msg := m.(message)
+						if _, ok := received[msg]; ok {
+							return fmt.Errorf("received duplicate message: %+v", msg)
+						}
+						received[msg] = struct{}{}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					var g sync.WaitGroup
+					errs := make(chan error, goroutines)
+
+					for i := range goroutines {
+						g.Add(1)
+						go func() {
+							defer g.Done()
+							for j := range perRoutine {
+								if err := Send(ctx, message{i, j}); err != nil {
+									errs <- err
+									return
+								}
+							}
+						}()
+					}
+
+					g.Wait()
+					close(errs)
+
+					return <-errs
+				},
+			),
+		)
 
-				m, err := Receive(ctx)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it continues to deliver messages to a function that has closed its outbox", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					if err := Send(ctx, "<message>"); err != nil {
+						return err
+					}
+
+					if err := CloseOutbox(ctx); err != nil {
+						return err
+					}
+
+					if err := Send(ctx, "<message>"); err != ErrOutboxClosed {
+						return fmt.Errorf("unexpected error from Send(): got %v, want %q", err, ErrOutboxClosed)
+					}
+
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+
+					return Send(ctx, 42)
+				},
+			),
+		)
+
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it returns ErrInboxClosed from Receive when the inbox is closed", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		receiveErr := make(chan error, 1)
+		funcErr := errors.New("<error from function>")
+
+		Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					// Use a context that is not canceled when the session shuts
+					// down, so that the closure of the inbox is observed.
+					_, err := Receive(context.WithoutCancel(ctx))
+					receiveErr <- err
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return funcErr
+				},
+			),
+		)
+
+		if err := <-receiveErr; err != ErrInboxClosed {
+			t.Fatalf("unexpected error from Receive(): got %v, want %q", err, ErrInboxClosed)
+		}
+	})
+
+	t.Run("it returns the context error from Receive when the context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		receiveErr := make(chan error, 2)
+		funcErr := errors.New("<error from function>")
+
+		Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					// Cancel a context derived from the function's context,
+					// while the inbox is still open.
+					canceled, cancel := context.WithCancel(ctx)
+					cancel()
+
+					_, err := Receive(canceled)
+					receiveErr <- err
+
+					// Wait for the session to shut down, which both cancels the
+					// context and closes the inbox.
+					<-ctx.Done()
+
+					_, err = Receive(ctx)
+					receiveErr <- err
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					time.Sleep(10 * time.Millisecond)
+					return funcErr
+				},
+			),
+		)
+
+		for range 2 {
+			if err := <-receiveErr; err != context.Canceled {
+				t.Fatalf("unexpected error from Receive(): got %v, want %q", err, context.Canceled)
+			}
+		}
+	})
+
+	t.Run("it delivers messages from each sender in order when inboxes are buffered", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const count = 100
+
+		receiver := func(ctx context.Context) error {
+			Subscribe[int](ctx)
+			Ready(ctx)
+
+			for want := range count {
+				got, err := ReceiveAs[int](ctx)
 				if err != nil {
 					return err
 				}
 
-				if started.Load() != 2 {
-					return fmt.Errorf("received a message before all signaled readiness: %q", m)
+				if got != want {
+					return fmt.Errorf("unexpected message: got %d, want %d", got, want)
 				}
+			}
 
-				return nil
-			},
-			func(ctx context.Context) error {
-				started.Add(1)
-				Ready(ctx)
+			return nil
+		}
+
+		err := Run(
+			ctx,
+			WithInboxBuffer(10),
+			Fork(2, receiver),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range count {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it delivers every message that was sent when the session shuts down cleanly", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		const (
+			producers = 8
+			burst     = 250
+		)
+
+		options := []Option{
+			WithOutboxBuffer(64),
+			WithInboxBuffer(16),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					seen := map[int]struct{}{}
+					for len(seen) < producers*burst {
+						m, err := ReceiveAs[int](ctx)
+						if err != nil {
+							return fmt.Errorf("received %d of %d messages: %w", len(seen), producers*burst, err)
+						}
+						seen[m] = struct{}{}
+					}
+
+					return nil
+				},
+			),
+		}
+
+		for p := range producers {
+			options = append(
+				options,
+				WithFunc(
+					func(ctx context.Context) error {
+						Ready(ctx)
+
+						for i := range burst {
+							if err := Send(ctx, p*burst+i); err != nil {
+								return err
+							}
+						}
+
+						// Half of the producers return with messages still
+						// buffered in their outbox, the others close it first.
+						if p%2 == 0 {
+							return nil
+						}
+
+						return CloseOutbox(ctx)
+					},
+				),
+			)
+		}
+
+		for range 20 {
+			if err := Run(ctx, options...); err != nil {
+				t.Fatalf("Run() returned an unexpected error: %s", err)
+			}
+		}
+	})
+
+	t.Run("it delivers messages from a single sender in the order they were sent", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const count = 1000
+
+		receiver := func(ctx context.Context) error {
+			Subscribe[int](ctx)
+			Ready(ctx)
 
-				if err := Send(ctx, "<message>"); err != nil {
+			for want := range count {
+				got, err := ReceiveAs[int](ctx)
+				if err != nil {
 					return err
 				}
 
-				if started.Load() != 2 {
-					return fmt.Errorf("sent a message before all functions signaled readiness")
+				if got != want {
+					return fmt.Errorf("unexpected message: got %d, want %d", got, want)
 				}
+			}
 
-				return nil
-			},
+			return nil
+		}
+
+		err := Run(
+			ctx,
+			Fork(3, receiver),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range count {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
 		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it only delivers messages to the function that sent them when self-delivery is enabled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var withSelf, withoutSelf []string
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					if err := Send(ctx, "<with>"); err != nil {
+						return err
+					}
+
+					for range 2 {
+						m, err := ReceiveAs[string](ctx)
+						if err != nil {
+							return err
+						}
+						withSelf = append(withSelf, m)
+					}
+
+					return nil
+				},
+				WithSelfDelivery(),
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					if err := Send(ctx, "<without>"); err != nil {
+						return err
+					}
+
+					m, err := ReceiveAs[string](ctx)
+					if err != nil {
+						return err
+					}
+					withoutSelf = append(withoutSelf, m)
 
+					if m, err := ReceiveTimeout(ctx, 20*time.Millisecond); err != context.DeadlineExceeded {
+						return fmt.Errorf("unexpected message: %v", m)
+					}
+
+					return nil
+				},
+			),
+		)
 		if err != nil {
 			t.Fatalf("Run() returned an unexpected error: %s", err)
 		}
+
+		slices.Sort(withSelf)
+
+		if want := []string{"<with>", "<without>"}; !slices.Equal(withSelf, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", withSelf, want)
+		}
+
+		if want := []string{"<with>"}; !slices.Equal(withoutSelf, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", withoutSelf, want)
+		}
 	})
 
-	t.Run("it does not deliver messages to the function that sent them", func(t *testing.T) {
+	t.Run("it limits the number of concurrent deliveries when WithDeliveryConcurrency is used", func(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 		defer cancel()
 
+		// Each delivery records a span for as long as it's in progress, which
+		// allows the number of concurrent deliveries to be counted.
+		counter := &deliveryCounter{}
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(counter))
+
+		const limit = 2
+
 		err := Run(
 			ctx,
-			func(ctx context.Context) error {
-				Subscribe[string](ctx)
-				Ready(ctx)
+			WithTracer(provider.Tracer("<tracer>")),
+			WithDeliveryConcurrency(limit),
+			Fork(
+				5,
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
 
-				err := Send(ctx, "<message>")
-				if err != nil {
+					// Delay receiving so that the deliveries overlap.
+					time.Sleep(10 * time.Millisecond)
+
+					_, err := Receive(ctx)
 					return err
-				}
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, "<message>")
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		// The deliveries must overlap, otherwise the limit is not exercised.
+		if n := counter.max.Load(); n != limit {
+			t.Fatalf("unexpected number of concurrent deliveries: got %d, want %d", n, limit)
+		}
+	})
+
+	t.Run("it delivers messages in order when WithDeliveryWorkers is used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const count = 100
+
+		err := Run(
+			ctx,
+			WithDeliveryWorkers(2),
+			Fork(
+				5,
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					for want := range count {
+						got, err := ReceiveAs[int](ctx)
+						if err != nil {
+							return err
+						}
+
+						if got != want {
+							return fmt.Errorf("unexpected message: got %d, want %d", got, want)
+						}
+					}
 
-				select {
-				case <-time.After(50 * time.Millisecond):
 					return nil
-				case <-Inbox(ctx):
-					return errors.New("function received a message from itself")
-				}
-			},
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range count {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it delivers messages in order when WithInlineDelivery is used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const count = 100
+
+		err := Run(
+			ctx,
+			WithInlineDelivery(),
+			Fork(
+				5,
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					for want := range count {
+						got, err := ReceiveAs[int](ctx)
+						if err != nil {
+							return err
+						}
+
+						if got != want {
+							return fmt.Errorf("unexpected message: got %d, want %d", got, want)
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range count {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it reports deliveries that block for longer than the slow subscriber threshold", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		type report struct {
+			Name string
+			Type reflect.Type
+		}
+
+		var (
+			m       sync.Mutex
+			reports []report
 		)
 
+		err := Run(
+			ctx,
+			WithSlowSubscriberThreshold(
+				10*time.Millisecond,
+				func(_ context.Context, name string, t reflect.Type) {
+					m.Lock()
+					defer m.Unlock()
+					reports = append(reports, report{name, t})
+				},
+			),
+			WithNamedFunc(
+				"<slow>",
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					time.Sleep(50 * time.Millisecond)
+
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return SendSync(ctx, "<message>")
+				},
+			),
+		)
 		if err != nil {
 			t.Fatalf("Run() returned an unexpected error: %s", err)
 		}
+
+		want := []report{{"<slow>", reflect.TypeFor[string]()}}
+		if !slices.Equal(reports, want) {
+			t.Fatalf("unexpected reports: got %v, want %v", reports, want)
+		}
+	})
+
+	t.Run("it delivers messages in order, including those buffered when the sender returns, when WithOutboxBuffer is used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const count = 1000
+
+		err := Run(
+			ctx,
+			WithOutboxBuffer(100),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					for want := range count {
+						got, err := ReceiveAs[int](ctx)
+						if err != nil {
+							return err
+						}
+
+						if got != want {
+							return fmt.Errorf("unexpected message: got %d, want %d", got, want)
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range count {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it delivers buffered messages from a function that returns before all functions are ready when WithOutboxBuffer is used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		want := []string{"<one>", "<two>", "<three>"}
+		var got []string
+
+		err := Run(
+			ctx,
+			WithOutboxBuffer(len(want)),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Broadcast(ctx, "<one>", "<two>", "<three>")
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					// Become ready late, so that the sender has already
+					// returned.
+					time.Sleep(20 * time.Millisecond)
+
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					for range want {
+						m, err := ReceiveAs[string](ctx)
+						if err != nil {
+							return err
+						}
+						got = append(got, m)
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("it delivers buffered messages after shutdown begins when WithOutboxBuffer and WithDrainTimeout are used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const count = 10
+		sent := make(chan struct{})
+		var got []int
+
+		err := Run(
+			ctx,
+			WithOutboxBuffer(count),
+			WithDrainTimeout(1*time.Second),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					// Don't read from the inbox until shutdown begins, so
+					// that the messages remain buffered in the outbox.
+					<-ctx.Done()
+
+					for m := range Inbox(ctx) {
+						got = append(got, m.(int))
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range count {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					close(sent)
+					<-ctx.Done()
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := WaitReady(ctx); err != nil {
+						return err
+					}
+
+					<-sent
+					return errors.New("<error>")
+				},
+			),
+		)
+		if err == nil || err.Error() != "<error>" {
+			t.Fatalf("unexpected error: got %v, want <error>", err)
+		}
+
+		if len(got) != count {
+			t.Fatalf("unexpected number of messages: got %d, want %d", len(got), count)
+		}
+
+		for want, m := range got {
+			if m != want {
+				t.Fatalf("unexpected message: got %d, want %d", m, want)
+			}
+		}
+	})
+
+	t.Run("it delivers messages of the types allowed by WithAllowedTypes", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var got string
+
+		err := Run(
+			ctx,
+			WithAllowedTypes(reflect.TypeFor[string]()),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, "<message>")
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					m, err := ReceiveAs[string](ctx)
+					got = m
+					return err
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if got != "<message>" {
+			t.Fatalf("unexpected message: got %q, want %q", got, "<message>")
+		}
+	})
+
+	t.Run("it fails the session if a message of a type that is not allowed by WithAllowedTypes is sent", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithAllowedTypes(reflect.TypeFor[string]()),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, 123)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					if _, err := Receive(ctx); err == nil {
+						return errors.New("unexpected message")
+					}
+
+					return nil
+				},
+			),
+		)
+		if !errors.Is(err, ErrTypeNotAllowed) {
+			t.Fatalf("unexpected error: got %v, want %v", err, ErrTypeNotAllowed)
+		}
+	})
+
+	t.Run("it delivers the first message to every function that subscribes before all functions are ready", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const n = 20
+
+		options := []Option{
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, &reader{Name: "<first>"})
+				},
+			),
+		}
+
+		for i := range n {
+			options = append(
+				options,
+				WithFunc(
+					func(ctx context.Context) error {
+						// Stagger the subscriptions so that they're made
+						// concurrently with the readiness of other functions.
+						time.Sleep(time.Duration(i%5) * time.Millisecond)
+
+						if i%2 == 0 {
+							Subscribe[*reader](ctx)
+						} else {
+							Subscribe[io.Reader](ctx)
+						}
+						Ready(ctx)
+
+						m, err := Receive(ctx)
+						if err != nil {
+							return err
+						}
+
+						if got := m.(*reader).Name; got != "<first>" {
+							return fmt.Errorf("unexpected message: got %q, want %q", got, "<first>")
+						}
+
+						return nil
+					},
+				),
+			)
+		}
+
+		if err := Run(ctx, options...); err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it delivers messages to functions that subscribe to an interface while messages that implement it are being routed", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const n = 20
+		var received atomic.Int64
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for range n {
+						if err := Spawn(
+							ctx,
+							func(ctx context.Context) error {
+								Subscribe[io.Reader](ctx)
+								Ready(ctx)
+
+								if _, err := Receive(ctx); err != nil {
+									return err
+								}
+
+								received.Add(1)
+								return nil
+							},
+						); err != nil {
+							return err
+						}
+					}
+
+					for received.Load() < n {
+						if err := Send(ctx, &reader{}); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it delivers messages of the types declared with Publish when WithStrictPublications is used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithStrictPublications(),
+			WithFunc(
+				func(ctx context.Context) error {
+					Publish[string](ctx)
+					Publish[io.Reader](ctx)
+					Ready(ctx)
+
+					return Broadcast(ctx, "<message>", &reader{})
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Subscribe[*reader](ctx)
+					Ready(ctx)
+
+					for range 2 {
+						if _, err := Receive(ctx); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it returns ErrNotPublished from Send if the type was not declared with Publish and WithStrictPublications is used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithStrictPublications(),
+			WithFunc(
+				func(ctx context.Context) error {
+					Publish[string](ctx)
+					Ready(ctx)
+
+					err := Send(ctx, 123)
+					if !errors.Is(err, ErrNotPublished) {
+						return fmt.Errorf("unexpected error: got %v, want %v", err, ErrNotPublished)
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it delivers messages of the types declared with WithOutputTypes when WithStrictPublications is used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithStrictPublications(),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, 123)
+				},
+				WithOutputTypes(reflect.TypeFor[int]()),
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it sends messages of types that were not declared with Publish when WithStrictPublications is not used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Publish[string](ctx)
+					Ready(ctx)
+					return Send(ctx, 123)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it delivers every message to a function that receives from both Inbox and Receive", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range 3 {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					if m := <-Inbox(ctx); m != 0 {
+						return fmt.Errorf("unexpected message from Inbox: got %v, want 0", m)
+					}
+
+					for want := 1; want < 3; want++ {
+						m, err := ReceiveAs[int](ctx)
+						if err != nil {
+							return err
+						}
+						if m != want {
+							return fmt.Errorf("unexpected message from Receive: got %d, want %d", m, want)
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it delivers messages from all senders in the same order to every recipient when WithTotalOrder is used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const (
+			senders    = 3
+			recipients = 3
+			count      = 100
+		)
+
+		var received [recipients][]int
+
+		sender := func(n int) Func {
+			return func(ctx context.Context) error {
+				Ready(ctx)
+
+				for i := range count {
+					if err := Send(ctx, n*count+i); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			}
+		}
+
+		recipient := func(n int) Func {
+			return func(ctx context.Context) error {
+				Subscribe[int](ctx)
+				Ready(ctx)
+
+				for range senders * count {
+					m, err := ReceiveAs[int](ctx)
+					if err != nil {
+						return err
+					}
+					received[n] = append(received[n], m)
+				}
+
+				return nil
+			}
+		}
+
+		options := []Option{
+			WithTotalOrder[int](),
+		}
+
+		for n := range senders {
+			options = append(options, WithFunc(sender(n)))
+		}
+
+		for n := range recipients {
+			options = append(options, WithFunc(recipient(n)))
+		}
+
+		if err := Run(ctx, options...); err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		for n := 1; n < recipients; n++ {
+			if !slices.Equal(received[n], received[0]) {
+				t.Fatalf("recipient %d received messages in a different order to recipient 0", n)
+			}
+		}
 	})
 }
@@ -0,0 +1,66 @@
+package minibus
+
+import (
+	"context"
+	"errors"
+)
+
+// Middleware is a function that intercepts messages as they are exchanged
+// between functions. It returns the message to use in place of m.
+//
+// See [WithOutboundMiddleware] and [WithInboundMiddleware].
+type Middleware func(ctx context.Context, m any) (any, error)
+
+// ErrDropMessage may be returned by inbound middleware to drop a message,
+// instead of delivering it to its recipients.
+//
+// See [WithInboundMiddleware].
+var ErrDropMessage = errors.New("minibus: message dropped by middleware")
+
+// applyOutbound passes env's message through the outbound middleware, and
+// returns the envelope to route.
+func (f *function) applyOutbound(ctx context.Context, env envelope) (envelope, error) {
+	// Only messages that are routed by their dynamic type are re-routed if
+	// the middleware changes their type.
+	isDynamic := env.Type == envelopeOf(env.Message).Type
+
+	for _, mw := range f.Config.Outbound {
+		m, err := mw(ctx, env.Message)
+		if err != nil {
+			return envelope{}, err
+		}
+		env.Message = m
+	}
+
+	if isDynamic {
+		env.Type = envelopeOf(env.Message).Type
+	}
+
+	return env, nil
+}
+
+// applyInbound passes env's message through the inbound middleware. It returns
+// false if the message is dropped.
+func (f *function) applyInbound(ctx context.Context, env envelope) (envelope, bool, error) {
+	for _, mw := range f.Config.Inbound {
+		m, err := mw(ctx, env.Message)
+		if errors.Is(err, ErrDropMessage) {
+			return env, false, nil
+		} else if err != nil {
+			return envelope{}, false, err
+		}
+
+		env.Message = m
+	}
+
+	return env, true, nil
+}
+
+// fail shuts down the session because of an error that occurred outside of
+// any function, such as within middleware.
+func (f *function) fail(ctx context.Context, err error) {
+	select {
+	case <-ctx.Done():
+	case f.FailSignal <- err:
+	}
+}
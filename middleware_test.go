@@ -0,0 +1,240 @@
+package minibus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestWithOutboundMiddleware(t *testing.T) {
+	t.Run("it sends the message returned by the middleware", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received any
+
+		err := Run(
+			ctx,
+			WithOutboundMiddleware(
+				func(_ context.Context, m any) (any, error) {
+					return fmt.Sprint(m), nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					m, err := Receive(ctx)
+					received = m
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, 42)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if received != "42" {
+			t.Fatalf("unexpected message: got %#v, want %q", received, "42")
+		}
+	})
+
+	t.Run("it returns the error returned by the middleware", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		mwErr := errors.New("<error>")
+
+		err := Run(
+			ctx,
+			WithOutboundMiddleware(
+				func(context.Context, any) (any, error) {
+					return nil, mwErr
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := Send(ctx, 42); err != nil {
+						return err
+					}
+
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			),
+		)
+
+		if err != mwErr {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, mwErr)
+		}
+	})
+}
+
+func TestWithInboundMiddleware(t *testing.T) {
+	t.Run("it drops messages when the middleware returns ErrDropMessage", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received []int
+
+		err := Run(
+			ctx,
+			WithInboundMiddleware(
+				func(_ context.Context, m any) (any, error) {
+					if m.(int)%2 != 0 {
+						return nil, ErrDropMessage
+					}
+					return m, nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					for range 3 {
+						m, err := ReceiveAs[int](ctx)
+						if err != nil {
+							return err
+						}
+						received = append(received, m)
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range 5 {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if want := []int{0, 2, 4}; !slices.Equal(received, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", received, want)
+		}
+	})
+
+	t.Run("it delivers nil messages returned by the middleware", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithInboundMiddleware(
+				func(context.Context, any) (any, error) {
+					return nil, nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					m, err := Receive(ctx)
+					if err != nil {
+						return err
+					}
+					if m != nil {
+						return fmt.Errorf("unexpected message: got %v, want nil", m)
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, 123)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+}
+
+func TestWithInboxInterceptor(t *testing.T) {
+	t.Run("it transforms or drops the messages delivered to the function", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var intercepted, unaffected []int
+
+		receive := func(n int, out *[]int) Func {
+			return func(ctx context.Context) error {
+				Subscribe[int](ctx)
+				Ready(ctx)
+
+				for range n {
+					m, err := ReceiveAs[int](ctx)
+					if err != nil {
+						return err
+					}
+					*out = append(*out, m)
+				}
+
+				return nil
+			}
+		}
+
+		err := Run(
+			ctx,
+			WithFunc(
+				receive(2, &intercepted),
+				WithInboxInterceptor(
+					func(_ context.Context, m any) (any, bool) {
+						if n := m.(int); n%2 == 0 {
+							return n * 10, true
+						}
+						return nil, false
+					},
+				),
+			),
+			WithFunc(receive(4, &unaffected)),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Broadcast(ctx, 0, 1, 2, 3)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if want := []int{0, 20}; !slices.Equal(intercepted, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", intercepted, want)
+		}
+
+		if want := []int{0, 1, 2, 3}; !slices.Equal(unaffected, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", unaffected, want)
+		}
+	})
+}
@@ -0,0 +1,942 @@
+package minibus
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option is an option that changes the behavior of [Run].
+type Option func(*config)
+
+// config is the configuration of a call to [Run], as built by its options.
+type config struct {
+	Funcs              []funcConfig
+	AggregateErrors    bool
+	InboxBuffer        int
+	Logger             *slog.Logger
+	LogLevel           slog.Level
+	Tracer             trace.Tracer
+	DeadLetter         func(context.Context, any)
+	DrainTimeout       time.Duration
+	Outbound           []Middleware
+	Inbound            []Middleware
+	Stats              Stats
+	Deterministic      bool
+	ContextKeys        []any
+	Concurrency        int
+	Workers            int
+	Inline             bool
+	SlowThreshold      time.Duration
+	SlowReadyThreshold time.Duration
+	SlowSubscriber     func(context.Context, string, reflect.Type)
+	Inspect            func(*Inspector)
+	Report             *Report
+	Ready              func()
+	DetectDeadlock     bool
+	OutboxBuffer       int
+	AllowedTypes       map[reflect.Type]struct{}
+	PanicPolicy        PanicPolicy
+	Events             chan<- Event
+	StrictPublications bool
+	TotalOrder         map[reflect.Type]*sync.Mutex
+	RequireSubscribers bool
+	Context            []func(context.Context) context.Context
+	Copy               func(any) any
+	Subscriptions      SubscriptionSnapshot
+	Routing            func(any, []string) []string
+	QueueDepth         map[reflect.Type]*queueDepth
+	WarningHandler     func(context.Context, string, error)
+	Clock              Clock
+	DeliveryPolicy     DeliveryPolicy
+	FairDelivery       bool
+	StartBatch         int
+}
+
+// FuncOption is an option that changes the behavior of a single function
+// executed by [Run].
+type FuncOption func(*funcConfig)
+
+// funcConfig is the configuration of a single function executed by [Run].
+type funcConfig struct {
+	Func         Func
+	Name         string
+	SelfDelivery bool
+	Publications []reflect.Type
+	Interceptor  func(context.Context, any) (any, bool)
+	LateJoin     bool
+	Group        string
+}
+
+// newFuncConfig returns the configuration for fn, built by the given options.
+func newFuncConfig(fn Func, name string, options []FuncOption) funcConfig {
+	cfg := funcConfig{
+		Func: fn,
+		Name: name,
+	}
+
+	for _, opt := range options {
+		opt(&cfg)
+	}
+
+	return cfg
+}
+
+// WithFunc is an [Option] that adds a function to be executed by [Run].
+//
+// The function is named after the Go function that implements it. Use
+// [WithNamedFunc] to give it a more meaningful name.
+func WithFunc(fn Func, options ...FuncOption) Option {
+	if fn == nil {
+		panic("minibus: WithFunc() must not be called with a nil function")
+	}
+
+	fc := newFuncConfig(fn, funcName(fn), options)
+
+	return func(cfg *config) {
+		cfg.Funcs = append(cfg.Funcs, fc)
+	}
+}
+
+// WithNamedFunc is an [Option] that adds a function with the given name to be
+// executed by [Run].
+//
+// The name is used to identify the function in log and trace output, and is
+// available to the function itself via [Name]. It need not be unique.
+func WithNamedFunc(name string, fn Func, options ...FuncOption) Option {
+	if fn == nil {
+		panic("minibus: WithNamedFunc() must not be called with a nil function")
+	}
+
+	fc := newFuncConfig(fn, name, options)
+
+	return func(cfg *config) {
+		cfg.Funcs = append(cfg.Funcs, fc)
+	}
+}
+
+// WithSelfDelivery is a [FuncOption] that causes the function to receive the
+// messages that it sends itself, if it subscribes to them.
+//
+// By default a function never receives its own messages. Note that a function
+// that uses this option must continue to receive messages from its inbox while
+// it is sending, otherwise the delivery of its own messages blocks its further
+// sends. The [WithInboxBuffer] option may help to avoid this.
+func WithSelfDelivery() FuncOption {
+	return func(cfg *funcConfig) {
+		cfg.SelfDelivery = true
+	}
+}
+
+// WithInboxInterceptor is a [FuncOption] that calls fn with each message
+// before it's placed in the function's inbox.
+//
+// fn returns the message to place in the inbox, which may differ from the
+// message that was sent, such as to decode or validate it. If it returns false
+// the message is dropped, and never occupies space in the inbox. Unlike
+// [WithInboundMiddleware], it applies only to the messages delivered to this
+// function, and other recipients of the same message are unaffected.
+//
+// fn is called by the delivery goroutine, so it may be called concurrently,
+// and it should not block. The message type used to route the message is not
+// changed, even if fn returns a message of a different type.
+func WithInboxInterceptor(fn func(ctx context.Context, m any) (any, bool)) FuncOption {
+	if fn == nil {
+		panic("minibus: WithInboxInterceptor() must not be called with a nil function")
+	}
+
+	return func(cfg *funcConfig) {
+		cfg.Interceptor = fn
+	}
+}
+
+// WithLateJoin is a [FuncOption] that excludes the function from the barrier
+// that waits for all functions to call [Ready] before messages are exchanged.
+//
+// The other functions begin exchanging messages without waiting for this
+// function, which joins the exchange once it calls [Ready], just like a
+// function started by [Spawn]. It may receive messages as soon as it
+// subscribes to them, and the messages it sends are delivered once it's ready.
+// Messages sent before it subscribes are not delivered to it, except for those
+// sent using [SendRetained].
+//
+// It's useful for functions that are slow to start, such as those that must
+// first connect to an external service, and that the other functions do not
+// depend upon. [WaitReady] still waits for the other functions to be ready.
+func WithLateJoin() FuncOption {
+	return func(cfg *funcConfig) {
+		cfg.LateJoin = true
+	}
+}
+
+// WithGroup is a [FuncOption] that adds the function to the named group.
+//
+// The members of a group compete for messages, rather than each receiving
+// them. Each message is delivered to a single member of each group that
+// subscribes to its type, chosen at random, or by key if the message is sent
+// using [SendSharded]. The message is still delivered to the subscribers that
+// are not in a group, and to a member of each other group. Messages sent to a
+// specific function using [SendTo] are unaffected.
+//
+// It's useful for distributing work between several copies of a function, such
+// as those added by [Fork]. Use the [WithFairDelivery] option to share the
+// messages evenly between the members. Group selection happens before the
+// [WithRouting] option is applied.
+//
+// It panics if name is empty.
+func WithGroup(name string) FuncOption {
+	if name == "" {
+		panic("minibus: WithGroup() must not be called with an empty name")
+	}
+
+	return func(cfg *funcConfig) {
+		cfg.Group = name
+	}
+}
+
+// WithOutputTypes is a [FuncOption] that declares that the function sends
+// messages of the given types, as though it had called [Publish] with each of
+// them.
+//
+// Declaring a function's output types when it's added allows [Run] to check
+// the session's topology before any messages are exchanged. Once all functions
+// are ready, a warning is logged for each declared type that no other function
+// subscribes to. If the [WithStrictPublications] option is used, a warning is
+// also logged for each subscribed type that no other function declares.
+// Use the [WithRequireSubscribers] option to fail instead.
+func WithOutputTypes(types ...reflect.Type) FuncOption {
+	for _, t := range types {
+		if t == nil {
+			panic("minibus: WithOutputTypes() must not be called with a nil type")
+		}
+	}
+
+	return func(cfg *funcConfig) {
+		cfg.Publications = append(cfg.Publications, types...)
+	}
+}
+
+// funcName returns the name of the Go function that implements fn.
+func funcName(fn Func) string {
+	return runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+}
+
+// Fork is an [Option] that adds n copies of fn to be executed by [Run], each
+// as an independent function.
+//
+// Each copy has its own inbox and subscriptions, so every copy that subscribes
+// to a message type receives its own copy of each message of that type. This
+// is useful for running several replicas of the same read-model, for example.
+//
+// Each copy is named after the Go function that implements fn, suffixed with
+// the copy's index, such as "pkg.Func#0", so that the copies can be told apart
+// in log and trace output.
+func Fork(n int, fn Func, options ...FuncOption) Option {
+	if fn == nil {
+		panic("minibus: Fork() must not be called with a nil function")
+	}
+
+	name := funcName(fn)
+
+	return func(cfg *config) {
+		for i := range n {
+			cfg.Funcs = append(
+				cfg.Funcs,
+				newFuncConfig(fn, name+"#"+strconv.Itoa(i), options),
+			)
+		}
+	}
+}
+
+// WithErrorAggregation is an [Option] that causes [Run] to return the errors
+// from all functions, instead of only the first.
+//
+// When a function returns an error the session is still shut down, but [Run]
+// waits for the remaining functions to return and combines all of their errors
+// using [errors.Join], in the order that the functions were added. Errors that
+// only indicate that the session was shut down, such as [context.Canceled],
+// are omitted.
+func WithErrorAggregation() Option {
+	return func(cfg *config) {
+		cfg.AggregateErrors = true
+	}
+}
+
+// WithInboxBuffer is an [Option] that gives each function's inbox a buffer
+// with capacity for n messages.
+//
+// By default inboxes are unbuffered, so a message is not considered delivered
+// until each recipient has received it from its inbox. Buffering decouples
+// fast senders from slow recipients, at the cost of delaying the point at
+// which a sender blocks. Messages from each sender are still delivered in the
+// order they were sent. Use [WithMaxQueueDepth] to bound the number of buffered
+// messages of a particular type across all inboxes.
+//
+// Messages that are already buffered in a function's inbox are still received
+// by that function after it calls [Unsubscribe].
+//
+// It panics if n is negative.
+func WithInboxBuffer(n int) Option {
+	if n < 0 {
+		panic("minibus: WithInboxBuffer() must not be called with a negative buffer size")
+	}
+
+	return func(cfg *config) {
+		cfg.InboxBuffer = n
+	}
+}
+
+// WithLogger is an [Option] that logs lifecycle events, such as functions
+// starting, subscribing, becoming ready and returning, to the given logger.
+//
+// Each record has the function's name as its "function" attribute. Lifecycle
+// events are logged at [slog.LevelDebug], and fine-grained events that may
+// occur many times per function, such as changes to its subscriptions, are
+// logged 4 levels below that. Events that may indicate a problem, such as those
+// described by [WithOutputTypes], are logged at [slog.LevelWarn].
+//
+// Events are also recorded in the runtime/trace log, regardless of this option.
+// Use [WithLogLevel] to limit the events that are recorded in both places.
+func WithLogger(logger *slog.Logger) Option {
+	return func(cfg *config) {
+		cfg.Logger = logger
+	}
+}
+
+// WithLogLevel is an [Option] that prevents events below the given level from
+// being logged, either to the logger configured by [WithLogger] or to the
+// runtime/trace log.
+//
+// See [WithLogger] for the levels at which each kind of event is logged. By
+// default, all events are logged. Use [slog.LevelDebug] to log lifecycle events
+// without the more verbose events, or [slog.LevelWarn] to log only those that
+// may indicate a problem.
+func WithLogLevel(level slog.Level) Option {
+	return func(cfg *config) {
+		cfg.LogLevel = level
+	}
+}
+
+// WithTracer is an [Option] that records OpenTelemetry spans for each message
+// exchanged by the functions.
+//
+// Each call to [Send] records a "minibus.publish <type>" span, and each
+// delivery of that message to a recipient records a "minibus.deliver <type>"
+// span as its child. A function can continue the trace of the message it most
+// recently received using [ReceivedSpanContext].
+//
+// Messages written directly to a function's [Outbox] channel do not have a
+// publish span, so their delivery spans have no parent.
+func WithTracer(tracer trace.Tracer) Option {
+	return func(cfg *config) {
+		cfg.Tracer = tracer
+	}
+}
+
+// WithDeadLetter is an [Option] that calls fn with each message that is sent
+// but has no recipients.
+//
+// A message has no recipients if no function other than the sender subscribes
+// to its type, or to any interface that it implements, or if it's sent using
+// [SendTo] to a function that does not subscribe to it.
+//
+// fn is called once per message, by the sending function's message pump. It
+// blocks the delivery of further messages from the same sender until it
+// returns, so it should not block.
+//
+// Each such message is also sent to any functions that subscribe to
+// [DeadLetter], whether or not this option is used.
+func WithDeadLetter(fn func(ctx context.Context, m any)) Option {
+	return func(cfg *config) {
+		cfg.DeadLetter = fn
+	}
+}
+
+// WithDrainTimeout is an [Option] that allows messages that are already being
+// delivered when [Run] begins to shut down to reach their recipients, for up to
+// d.
+//
+// Once shutdown begins, no further messages are read from any function's
+// outbox, and [Send] fails with the context's error. However, a message that
+// was sent before then, including one that is still buffered in the outbox as
+// per [WithOutboxBuffer], continues to be delivered to each recipient that is
+// still reading from its inbox, until the drain timeout elapses. A function
+// that wants to receive such messages must continue to read from [Inbox] after
+// its context is canceled, until the inbox is closed.
+//
+// Draining is best-effort; any message that is not delivered within d is
+// discarded.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.DrainTimeout = d
+	}
+}
+
+// WithOutboundMiddleware is an [Option] that passes each message that is sent
+// through mw before it is routed to its subscribers.
+//
+// The message returned by mw is sent in place of the original. It's routed
+// according to its dynamic type, unless the original message was sent using
+// [SendAs]. If mw returns an error, the session is shut down and [Run] returns
+// that error.
+//
+// Middleware is called by the sending function's message pump, so it may be
+// called concurrently. If this option is used more than once, the middleware
+// is applied in the order that the options are given.
+func WithOutboundMiddleware(mw Middleware) Option {
+	if mw == nil {
+		panic("minibus: WithOutboundMiddleware() must not be called with a nil middleware")
+	}
+
+	return func(cfg *config) {
+		cfg.Outbound = append(cfg.Outbound, mw)
+	}
+}
+
+// WithInboundMiddleware is an [Option] that passes each message through mw
+// before it is placed in the inboxes of its recipients.
+//
+// The message returned by mw is delivered in place of the original, even if
+// it's nil. If mw returns [ErrDropMessage] the message is dropped. If mw
+// returns any other error, the session is shut down and [Run] returns that
+// error.
+//
+// Unlike outbound middleware, which is applied to every message that is sent,
+// inbound middleware is only applied to messages that have at least one
+// recipient. It's called once per message, regardless of the number of
+// recipients.
+//
+// Middleware is called by the sending function's message pump, so it may be
+// called concurrently. If this option is used more than once, the middleware
+// is applied in the order that the options are given.
+func WithInboundMiddleware(mw Middleware) Option {
+	if mw == nil {
+		panic("minibus: WithInboundMiddleware() must not be called with a nil middleware")
+	}
+
+	return func(cfg *config) {
+		cfg.Inbound = append(cfg.Inbound, mw)
+	}
+}
+
+// WithStats is an [Option] that reports statistics about the functions and the
+// messages they exchange to s.
+func WithStats(s Stats) Option {
+	if s == nil {
+		panic("minibus: WithStats() must not be called with a nil Stats")
+	}
+
+	return func(cfg *config) {
+		cfg.Stats = s
+	}
+}
+
+// WithDeterministicOrder is an [Option] that delivers each message to its
+// recipients one at a time, in the order that the functions were added.
+//
+// By default a message is delivered to all of its recipients concurrently, so
+// the order in which they receive it is unpredictable. This option makes that
+// order reproducible, which is useful in tests, at the cost of a slow recipient
+// delaying delivery to the recipients after it.
+func WithDeterministicOrder() Option {
+	return func(cfg *config) {
+		cfg.Deterministic = true
+	}
+}
+
+// WithTotalOrder is an [Option] that delivers messages routed as type M one at
+// a time across all functions, so that every recipient receives them in the
+// same order.
+//
+// By default messages from different functions are delivered concurrently, so
+// two recipients may receive them in a different order. This option provides
+// the stronger guarantee required by replicated state machines, for example,
+// at the cost of serializing the delivery of all messages of type M: no message
+// of type M is delivered until the previous one has been delivered to all of
+// its recipients. Messages of other types are unaffected.
+//
+// M is the type used for routing, which is usually the message's dynamic type,
+// but it's the interface type for messages sent using [SendAs].
+func WithTotalOrder[M any]() Option {
+	t := reflect.TypeFor[M]()
+
+	return func(cfg *config) {
+		if cfg.TotalOrder == nil {
+			cfg.TotalOrder = map[reflect.Type]*sync.Mutex{}
+		}
+
+		if _, ok := cfg.TotalOrder[t]; !ok {
+			cfg.TotalOrder[t] = &sync.Mutex{}
+		}
+	}
+}
+
+// WithMaxQueueDepth is an [Option] that limits the number of undelivered
+// messages routed as type M to n.
+//
+// A message is undelivered from the time it's accepted by [Send] until each of
+// its recipients has received it from their inbox, so a message with several
+// recipients counts once for each of them that has yet to receive it. Once the
+// limit is reached, [Send] and its variants return an error that wraps
+// [ErrQueueFull] for further messages of type M, rather than buffering them,
+// until the recipients catch up. Messages of other types are unaffected. Use
+// [SendRetry] to retry such sends until the recipients catch up, or
+// [WithDeliveryPolicy] to wait for them or drop the messages instead.
+//
+// It protects against a fast producer of one type exhausting memory while the
+// consumers of that type lag behind, such as when large buffers are configured
+// using [WithInboxBuffer] or [WithOutboxBuffer].
+//
+// M is the type used for routing, which is usually the message's dynamic type,
+// but it's the interface type for messages sent using [SendAs]. Messages
+// written directly to the channel returned by [Outbox] are not counted.
+//
+// It panics if n is not positive.
+func WithMaxQueueDepth[M any](n int) Option {
+	if n <= 0 {
+		panic("minibus: WithMaxQueueDepth() must be called with a positive depth")
+	}
+
+	t := reflect.TypeFor[M]()
+
+	return func(cfg *config) {
+		if cfg.QueueDepth == nil {
+			cfg.QueueDepth = map[reflect.Type]*queueDepth{}
+		}
+
+		cfg.QueueDepth[t] = &queueDepth{Max: int64(n)}
+	}
+}
+
+// WithContextValues is an [Option] that propagates the values associated with
+// the given keys from the context passed to [Send] to the recipients of the
+// message.
+//
+// A recipient can obtain a context that carries the values of the message it
+// most recently received using [MessageContext]. This is useful for propagating
+// request-scoped data, such as correlation IDs, across the bus. Values of other
+// keys are not propagated.
+func WithContextValues(keys ...any) Option {
+	return func(cfg *config) {
+		cfg.ContextKeys = append(cfg.ContextKeys, keys...)
+	}
+}
+
+// WithDeliveryConcurrency is an [Option] that limits the number of recipients
+// to which each function's messages are delivered concurrently to n.
+//
+// By default, a message is delivered to all of its recipients concurrently,
+// which requires a goroutine for each recipient that is not ready to receive
+// it. With many subscribers this can result in a large number of goroutines.
+// Using this option, once n recipients are waiting for a message, delivery to
+// the remaining recipients waits until one of them has received it.
+//
+// If n is zero, the number of concurrent deliveries is unbounded. It panics if
+// n is negative.
+func WithDeliveryConcurrency(n int) Option {
+	if n < 0 {
+		panic("minibus: WithDeliveryConcurrency() must not be called with a negative limit")
+	}
+
+	return func(cfg *config) {
+		cfg.Concurrency = n
+	}
+}
+
+// WithDeliveryWorkers is an [Option] that delivers messages using a pool of n
+// goroutines that are shared by all functions, instead of starting a new
+// goroutine for each delivery. If n is zero, the pool has [runtime.GOMAXPROCS]
+// goroutines.
+//
+// This reduces the cost of delivering messages to many recipients at high
+// rates. Each goroutine in the pool is occupied until the recipient receives
+// the message, so when all of them are occupied, a new goroutine is started
+// for the delivery, just as it is without this option.
+//
+// It panics if n is negative.
+func WithDeliveryWorkers(n int) Option {
+	if n < 0 {
+		panic("minibus: WithDeliveryWorkers() must not be called with a negative number of workers")
+	}
+
+	if n == 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+
+	return func(cfg *config) {
+		cfg.Workers = n
+	}
+}
+
+// WithInlineDelivery is an [Option] that delivers each message to its
+// recipients one at a time, on the sending function's message pump, instead of
+// delivering to them concurrently.
+//
+// This avoids the cost of starting goroutines to deliver messages, which may
+// reduce latency in sessions with few functions and modest traffic. However,
+// a recipient that is slow to receive a message delays its delivery to the
+// remaining recipients, and the delivery of further messages from the same
+// sender. Use [WithInboxBuffer] to reduce the impact of such head-of-line
+// blocking, or [WithDeterministicOrder] to also deliver to the recipients in a
+// predictable order.
+func WithInlineDelivery() Option {
+	return func(cfg *config) {
+		cfg.Inline = true
+	}
+}
+
+// WithSlowSubscriberThreshold is an [Option] that calls fn each time the
+// delivery of a message to a single recipient is blocked for longer than d.
+//
+// fn is called with the name of the recipient and the type of the message. The
+// recipient is blocked if it does not receive from its inbox, or if its inbox
+// buffer is full. This signals back-pressure that would otherwise go unnoticed,
+// as the sender of a message is not blocked while it's being delivered.
+//
+// fn is called at most once per delivery, while the delivery is still blocked.
+// It may be called concurrently, and it should not block.
+func WithSlowSubscriberThreshold(
+	d time.Duration,
+	fn func(ctx context.Context, name string, t reflect.Type),
+) Option {
+	if fn == nil {
+		panic("minibus: WithSlowSubscriberThreshold() must not be called with a nil function")
+	}
+
+	return func(cfg *config) {
+		cfg.SlowThreshold = d
+		cfg.SlowSubscriber = fn
+	}
+}
+
+// WithDeadlockDetection is an [Option] that causes [Run] to return
+// [ErrDeadlock] if every running function is blocked receiving a message, and
+// there are no messages in flight that could unblock any of them.
+//
+// Without this option such a session blocks until its context is canceled.
+//
+// A function is only considered to be blocked while it's in a call to [Receive]
+// (or a helper built upon it, such as [ReceiveAs]) using the context passed to
+// it by [Run], as a derived context may be canceled or time out. Detection
+// assumes that functions do not send messages from other goroutines while they
+// are blocked receiving, and it's disabled entirely if any function calls
+// [Outbox], as messages written directly to the outbox can't be accounted for.
+func WithDeadlockDetection() Option {
+	return func(cfg *config) {
+		cfg.DetectDeadlock = true
+	}
+}
+
+// WithOutboxBuffer is an [Option] that gives each function's outbox a buffer
+// with capacity for n messages.
+//
+// By default outboxes are unbuffered, so [Send] blocks until the function's
+// message pump has finished delivering the previous message. Buffering allows
+// a function to send a burst of messages without waiting for each of them to
+// be routed. Messages from each sender are still delivered in the order they
+// were sent.
+//
+// Messages that are still buffered when the function returns or calls
+// [CloseOutbox] are delivered before its message pump stops. Messages that are
+// still buffered when [Run] shuts down are discarded, unless the
+// [WithDrainTimeout] option is used, in which case they're delivered along with
+// any messages that are already in flight.
+//
+// It panics if n is negative.
+func WithOutboxBuffer(n int) Option {
+	if n < 0 {
+		panic("minibus: WithOutboxBuffer() must not be called with a negative buffer size")
+	}
+
+	return func(cfg *config) {
+		cfg.OutboxBuffer = n
+	}
+}
+
+// WithAllowedTypes is an [Option] that restricts the messages that may be sent
+// to those routed as one of the given types.
+//
+// If a function sends a message of any other type, the session is shut down
+// and [Run] returns an error that wraps [ErrTypeNotAllowed]. The type that is
+// checked is the type used for routing, after any outbound middleware has been
+// applied. It's usually the message's dynamic type, but it's the interface type
+// for messages sent using [SendAs], and [any] for nil messages.
+//
+// If this option is used more than once, the types from each are allowed.
+func WithAllowedTypes(types ...reflect.Type) Option {
+	for _, t := range types {
+		if t == nil {
+			panic("minibus: WithAllowedTypes() must not be called with a nil type")
+		}
+	}
+
+	return func(cfg *config) {
+		if cfg.AllowedTypes == nil {
+			cfg.AllowedTypes = map[reflect.Type]struct{}{}
+		}
+
+		for _, t := range types {
+			cfg.AllowedTypes[t] = struct{}{}
+		}
+	}
+}
+
+// WithPanicPolicy is an [Option] that determines how [Run] responds when one
+// of its functions panics. The default policy is [FailSession].
+func WithPanicPolicy(p PanicPolicy) Option {
+	return func(cfg *config) {
+		cfg.PanicPolicy = p
+	}
+}
+
+// WithEventSink is an [Option] that sends an [Event] to ch for each function
+// that becomes ready or returns, and for each message that is sent, delivered
+// or dropped.
+//
+// Events are sent without blocking, so that a slow consumer can not stall the
+// session. Any event that can not be sent immediately is discarded, so ch
+// should be buffered, or be read continuously by another goroutine.
+//
+// Events that occur concurrently may be sent in any order. ch is not closed
+// when [Run] returns.
+func WithEventSink(ch chan<- Event) Option {
+	return func(cfg *config) {
+		cfg.Events = ch
+	}
+}
+
+// WithStrictPublications is an [Option] that only allows each function to send
+// messages of the types that it has declared using [Publish].
+//
+// [Send] and its variants return an error that wraps [ErrNotPublished] when a
+// function sends a message of any other type. Messages written directly to the
+// channel returned by [Outbox] are not checked.
+func WithStrictPublications() Option {
+	return func(cfg *config) {
+		cfg.StrictPublications = true
+	}
+}
+
+// WithRequireSubscribers is an [Option] that causes [Run] to fail before any
+// messages are exchanged if a function declares that it sends a message type
+// that no other function subscribes to.
+//
+// Types are declared using [Publish] or [WithOutputTypes]. Once all functions
+// are ready, [Run] shuts down the session and returns an error that wraps
+// [ErrNoSubscribers] if any declared type has no subscribers. This turns a
+// message that would otherwise be silently dropped into a startup failure. It
+// should not be used if some consumers are optional.
+func WithRequireSubscribers() Option {
+	return func(cfg *config) {
+		cfg.RequireSubscribers = true
+	}
+}
+
+// WithContext is an [Option] that applies fn to the context of each function
+// executed by [Run], before the function is called.
+//
+// It provides a single place to attach session-wide dependencies, such as
+// loggers or database handles, to the context of every function. The context
+// passed to fn is derived from the context passed to [Run]. fn must return a
+// context derived from the one it's given, such as by using
+// [context.WithValue].
+//
+// If this option is used more than once, each fn is applied in the order that
+// the options are given.
+func WithContext(fn func(context.Context) context.Context) Option {
+	if fn == nil {
+		panic("minibus: WithContext() must not be called with a nil function")
+	}
+
+	return func(cfg *config) {
+		cfg.Context = append(cfg.Context, fn)
+	}
+}
+
+// WithMessageCopy is an [Option] that replaces each message with the result of
+// fn at the time it's sent.
+//
+// Messages are passed to their recipients by value, but a message that is (or
+// contains) a pointer, slice or map shares its underlying data with the value
+// the sender still holds. A sender that modifies such a message after sending
+// it may corrupt what the recipients see, especially when the message is
+// buffered, as per [WithOutboxBuffer] and [WithInboxBuffer]. fn can return a
+// defensive copy to prevent this. [DeepCopy] is suitable for most messages.
+//
+// fn is called once for each message passed to [Send] and its variants, by the
+// sending goroutine, so all recipients of a message share the same copy. It
+// must return a value of the same type as the message. Messages written
+// directly to the channel returned by [Outbox] are not copied.
+func WithMessageCopy(fn func(any) any) Option {
+	if fn == nil {
+		panic("minibus: WithMessageCopy() must not be called with a nil function")
+	}
+
+	return func(cfg *config) {
+		cfg.Copy = fn
+	}
+}
+
+// WithSlowReadyThreshold is an [Option] that logs a warning for each function
+// that has not called [Ready] within d of [Run] being called.
+//
+// It's a diagnostic aid for sessions that never start exchanging messages,
+// because some function never becomes ready. The warnings are logged once, to
+// the runtime/trace log and to the logger configured by [WithLogger], if any.
+// Each has the function's name as its "function" attribute.
+func WithSlowReadyThreshold(d time.Duration) Option {
+	if d <= 0 {
+		panic("minibus: WithSlowReadyThreshold() must be called with a positive duration")
+	}
+
+	return func(cfg *config) {
+		cfg.SlowReadyThreshold = d
+	}
+}
+
+// WithSubscriptions is an [Option] that subscribes each function to the message
+// types in the snapshot that are associated with its name, before the function
+// is called.
+//
+// It restores the subscriptions captured by [Inspector.Subscriptions], such as
+// when a long-running session is rebuilt with new functions. Functions with
+// names that are not in the snapshot are unaffected, and names in the snapshot
+// that do not match any function are ignored. Filters are not captured in the
+// snapshot, so restored subscriptions receive every message of their type.
+func WithSubscriptions(snapshot SubscriptionSnapshot) Option {
+	return func(cfg *config) {
+		cfg.Subscriptions = snapshot
+	}
+}
+
+// WithRouting is an [Option] that uses fn to select which of the subscribers to
+// each message receive it.
+//
+// fn is called with the message and the names of the functions that would
+// otherwise receive it, in the order that they were added to [Run]. It returns
+// the names of those that should receive it, allowing strategies such as
+// content-based routing, round-robin or consistent hashing to be implemented.
+// If it selects none of them, the message has no recipients, as per
+// [WithDeadLetter].
+//
+// fn is not called for messages that have no subscribers, or that are sent to a
+// specific function using [SendTo]. It's called by the sending function's
+// message pump, so it may be called concurrently, and it should not block.
+func WithRouting(fn func(m any, subscribers []string) []string) Option {
+	if fn == nil {
+		panic("minibus: WithRouting() must not be called with a nil function")
+	}
+
+	return func(cfg *config) {
+		cfg.Routing = fn
+	}
+}
+
+// WithWarningHandler is an [Option] that calls fn with each warning reported by
+// a function using [Warn].
+//
+// fn is called with the name of the function that reported the warning, and
+// the error that describes it. It's called by the reporting function's
+// goroutine, so it may be called concurrently, and it should not block.
+func WithWarningHandler(fn func(ctx context.Context, name string, err error)) Option {
+	if fn == nil {
+		panic("minibus: WithWarningHandler() must not be called with a nil function")
+	}
+
+	return func(cfg *config) {
+		cfg.WarningHandler = fn
+	}
+}
+
+// WithClock is an [Option] that uses c as the source of time for time-based
+// behavior, such as the pacing performed by [IngestPaced].
+//
+// It's intended for tests, which can use a [Clock] that is advanced manually
+// to make such behavior deterministic.
+func WithClock(c Clock) Option {
+	if c == nil {
+		panic("minibus: WithClock() must not be called with a nil Clock")
+	}
+
+	return func(cfg *config) {
+		cfg.Clock = c
+	}
+}
+
+// WithDeliveryPolicy is an [Option] that determines how [Send] and its variants
+// behave when a message can't be accepted for delivery straight away.
+//
+// The policy is applied in two stages. First, if the message's type has a
+// limit set by [WithMaxQueueDepth], the policy's Overflow field determines
+// whether a message that exceeds the limit is rejected, waits for space, or is
+// dropped. Then, Send waits for the sender's outbox to accept the message,
+// which may take some time if the outbox is unbuffered or full. The policy's
+// Timeout field bounds the total time spent waiting in both stages.
+//
+// The cancellation of the context passed to Send takes precedence over the
+// policy, as does closing the sender's outbox using [CloseOutbox]. A message
+// that is dropped or rejected under the policy never waits, so the timeout
+// only applies to the [BlockWhenFull] policy and to the outbox.
+//
+// Without this option, the zero [DeliveryPolicy] is used.
+func WithDeliveryPolicy(p DeliveryPolicy) Option {
+	if p.Overflow < RejectWhenFull || p.Overflow > DropWhenFull {
+		panic("minibus: WithDeliveryPolicy() must be called with a valid overflow policy")
+	}
+	if p.Timeout < 0 {
+		panic("minibus: WithDeliveryPolicy() must not be called with a negative timeout")
+	}
+
+	return func(cfg *config) {
+		cfg.DeliveryPolicy = p
+	}
+}
+
+// WithFairDelivery is an [Option] that shares the messages delivered to each
+// group evenly between its members, as per [WithGroup].
+//
+// By default each message is delivered to a member of the group chosen at
+// random, so that over time each member receives a similar number of messages,
+// but any one member may receive a run of them. With this option, each message
+// is instead delivered to the member that has received the fewest messages, so
+// the members never differ by more than a few messages. A member that joins
+// the group later, such as one started by [Spawn], receives each message until
+// it has caught up with the others.
+//
+// It only affects groups of competing consumers. Subscribers that are not in a
+// group receive every message regardless, and messages sent using
+// [SendSharded] are still delivered according to their key.
+func WithFairDelivery() Option {
+	return func(cfg *config) {
+		cfg.FairDelivery = true
+	}
+}
+
+// WithStagedStart is an [Option] that starts the functions in batches of n,
+// instead of starting them all at once.
+//
+// Each batch is started only once every function in the previous batch has
+// called [Ready] or returned, which limits the number of goroutines that are
+// created, and compete for the scheduler, while the session is starting. It's
+// useful for sessions with a very large number of functions. Messages are
+// still only exchanged once every function has called [Ready], so the
+// functions in the earlier batches wait for those in the later ones.
+//
+// Functions that use [WithLateJoin] do not delay the next batch.
+//
+// It panics if n is not positive.
+func WithStagedStart(n int) Option {
+	if n <= 0 {
+		panic("minibus: WithStagedStart() must be called with a positive batch size")
+	}
+
+	return func(cfg *config) {
+		cfg.StartBatch = n
+	}
+}
@@ -1,8 +1,19 @@
 package minibus_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"reflect"
+	"runtime"
+	"runtime/trace"
+	"slices"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -16,16 +27,20 @@ func TestRun_orchestration(t *testing.T) {
 
 		err := Run(
 			context.Background(),
-			func(context.Context) error {
-				time.Sleep(10 * time.Millisecond)
-				calledA.Store(true)
-				return nil
-			},
-			func(context.Context) error {
-				time.Sleep(10 * time.Millisecond)
-				calledB.Store(true)
-				return nil
-			},
+			WithFunc(
+				func(context.Context) error {
+					time.Sleep(10 * time.Millisecond)
+					calledA.Store(true)
+					return nil
+				},
+			),
+			WithFunc(
+				func(context.Context) error {
+					time.Sleep(10 * time.Millisecond)
+					calledB.Store(true)
+					return nil
+				},
+			),
 		)
 
 		if err != nil {
@@ -59,14 +74,18 @@ func TestRun_orchestration(t *testing.T) {
 
 		err := Run(
 			ctx,
-			func(ctx context.Context) error {
-				<-ctx.Done()
-				ctxErr <- ctx.Err()
-				return nil
-			},
-			func(context.Context) error {
-				return funcErr
-			},
+			WithFunc(
+				func(ctx context.Context) error {
+					<-ctx.Done()
+					ctxErr <- ctx.Err()
+					return nil
+				},
+			),
+			WithFunc(
+				func(context.Context) error {
+					return funcErr
+				},
+			),
 		)
 
 		t.Run("it returns the function's error", func(t *testing.T) {
@@ -100,11 +119,13 @@ func TestRun_orchestration(t *testing.T) {
 
 		err := Run(
 			ctx,
-			func(ctx context.Context) error {
-				<-ctx.Done()
-				ctxErr <- ctx.Err()
-				return funcErr
-			},
+			WithFunc(
+				func(ctx context.Context) error {
+					<-ctx.Done()
+					ctxErr <- ctx.Err()
+					return funcErr
+				},
+			),
 		)
 
 		t.Run("it returns the context error", func(t *testing.T) {
@@ -124,4 +145,1589 @@ func TestRun_orchestration(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("when a function panics", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		ctxErr := make(chan error, 1)
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					<-ctx.Done()
+					ctxErr <- ctx.Err()
+					return nil
+				},
+			),
+			WithFunc(
+				func(context.Context) error {
+					panic("<panic>")
+				},
+			),
+		)
+
+		t.Run("it returns a PanicError", func(t *testing.T) {
+			var p *PanicError
+			if !errors.As(err, &p) {
+				t.Fatalf("Run() returned an unexpected error: got %q, want a *PanicError", err)
+			}
+
+			if p.Value() != "<panic>" {
+				t.Fatalf("unexpected panic value: got %v, want %q", p.Value(), "<panic>")
+			}
+
+			if len(p.Stack()) == 0 {
+				t.Fatal("expected a stack trace")
+			}
+		})
+
+		t.Run("it cancels the context that it passes to the functions", func(t *testing.T) {
+			select {
+			case err := <-ctxErr:
+				if err != context.Canceled {
+					t.Fatalf("Run() did not cancel the context that it passed to the functions: got %q, want %q", err, context.Canceled)
+				}
+			default:
+				t.Fatalf("Run() did not cancel the context that it passed to the functions")
+			}
+		})
+	})
+
+	t.Run("when a function panics and the FailSession panic policy is used", func(t *testing.T) {
+		t.Run("it returns a PanicError", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			err := Run(
+				ctx,
+				WithPanicPolicy(FailSession),
+				WithFunc(
+					func(ctx context.Context) error {
+						<-ctx.Done()
+						return nil
+					},
+				),
+				WithFunc(
+					func(context.Context) error {
+						panic("<panic>")
+					},
+				),
+			)
+
+			var p *PanicError
+			if !errors.As(err, &p) {
+				t.Fatalf("Run() returned an unexpected error: got %q, want a *PanicError", err)
+			}
+		})
+	})
+
+	t.Run("when a function panics and the IsolateFunction panic policy is used", func(t *testing.T) {
+		t.Run("it continues to run the other functions", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			panicked := make(chan struct{})
+			var got string
+
+			err := Run(
+				ctx,
+				WithPanicPolicy(IsolateFunction),
+				WithFunc(
+					func(ctx context.Context) error {
+						Ready(ctx)
+
+						select {
+						case <-ctx.Done():
+							return ctx.Err()
+						case <-panicked:
+						}
+
+						return Send(ctx, "<message>")
+					},
+				),
+				WithFunc(
+					func(ctx context.Context) error {
+						Subscribe[string](ctx)
+						Ready(ctx)
+
+						m, err := ReceiveAs[string](ctx)
+						got = m
+						return err
+					},
+				),
+				WithFunc(
+					func(ctx context.Context) error {
+						Ready(ctx)
+						close(panicked)
+						panic("<panic>")
+					},
+				),
+			)
+			if err != nil {
+				t.Fatalf("Run() returned an unexpected error: %s", err)
+			}
+
+			if got != "<message>" {
+				t.Fatalf("unexpected message: got %q, want %q", got, "<message>")
+			}
+		})
+
+		t.Run("it removes the function's subscriptions", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			panicked := make(chan struct{})
+			deadLetters := make(chan any, 1)
+
+			err := Run(
+				ctx,
+				WithPanicPolicy(IsolateFunction),
+				WithDeadLetter(
+					func(_ context.Context, m any) {
+						deadLetters <- m
+					},
+				),
+				WithFunc(
+					func(ctx context.Context) error {
+						Ready(ctx)
+
+						select {
+						case <-ctx.Done():
+							return ctx.Err()
+						case <-panicked:
+						}
+
+						// Wait for the panicking function to be removed from
+						// the session.
+						for Peers(ctx) != 0 {
+							time.Sleep(time.Millisecond)
+						}
+
+						if err := Send(ctx, "<message>"); err != nil {
+							return err
+						}
+
+						select {
+						case <-ctx.Done():
+							return ctx.Err()
+						case <-deadLetters:
+							return nil
+						}
+					},
+				),
+				WithFunc(
+					func(ctx context.Context) error {
+						Subscribe[string](ctx)
+						Ready(ctx)
+						close(panicked)
+						panic("<panic>")
+					},
+				),
+			)
+			if err != nil {
+				t.Fatalf("Run() returned an unexpected error: %s", err)
+			}
+		})
+	})
+
+	t.Run("when the WithErrorAggregation option is used", func(t *testing.T) {
+		t.Run("it returns the errors from all functions", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			errA := errors.New("<error A>")
+			errB := errors.New("<error B>")
+
+			err := Run(
+				ctx,
+				WithErrorAggregation(),
+				WithFunc(
+					func(ctx context.Context) error {
+						<-ctx.Done()
+						return errA
+					},
+				),
+				WithFunc(
+					func(ctx context.Context) error {
+						<-ctx.Done()
+						return ctx.Err()
+					},
+				),
+				WithFunc(
+					func(context.Context) error {
+						return errB
+					},
+				),
+			)
+
+			if want := errors.Join(errA, errB); err == nil || err.Error() != want.Error() {
+				t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, want)
+			}
+		})
+
+		t.Run("it returns nil if no function fails", func(t *testing.T) {
+			err := Run(
+				context.Background(),
+				WithErrorAggregation(),
+				WithFunc(
+					func(context.Context) error {
+						return nil
+					},
+				),
+			)
+
+			if err != nil {
+				t.Fatalf("Run() returned an unexpected error: %q", err)
+			}
+		})
+	})
+
+	t.Run("it does not leave any goroutines running after it returns", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+
+		for range 100 {
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+
+			Run(
+				ctx,
+				WithFunc(
+					func(ctx context.Context) error {
+						Subscribe[int](ctx)
+						Ready(ctx)
+						<-ctx.Done()
+						return nil
+					},
+				),
+				WithFunc(
+					func(ctx context.Context) error {
+						Subscribe[int](ctx)
+						Ready(ctx)
+						return errors.New("<error>")
+					},
+				),
+				WithFunc(
+					func(ctx context.Context) error {
+						Ready(ctx)
+						for i := 0; ; i++ {
+							if err := Send(ctx, i); err != nil {
+								return err
+							}
+						}
+					},
+				),
+			)
+
+			cancel()
+		}
+
+		if after := runtime.NumGoroutine(); after != before {
+			t.Fatalf("unexpected number of goroutines after Run() returned: got %d, want %d", after, before)
+		}
+	})
+
+	t.Run("it executes each copy of a forked function independently", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received atomic.Int32
+
+		err := Run(
+			ctx,
+			Fork(
+				3,
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+
+					received.Add(1)
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, "<message>")
+				},
+			),
+		)
+
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+
+		if n := received.Load(); n != 3 {
+			t.Fatalf("unexpected number of forked functions received the message: got %d, want 3", n)
+		}
+	})
+
+	t.Run("it names each function", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var named, unnamed string
+
+		err := Run(
+			ctx,
+			WithNamedFunc(
+				"<name>",
+				func(ctx context.Context) error {
+					named = Name(ctx)
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					unnamed = Name(ctx)
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+
+		if named != "<name>" {
+			t.Fatalf("unexpected name: got %q, want %q", named, "<name>")
+		}
+
+		if !strings.HasPrefix(unnamed, "github.com/dogmatiq/minibus_test.TestRun_orchestration.") {
+			t.Fatalf("unexpected name: got %q, want the name of the Go function", unnamed)
+		}
+	})
+
+	t.Run("it names each copy of a forked function after its index", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const count = 3
+
+		var (
+			m     sync.Mutex
+			names []string
+		)
+
+		err := Run(
+			ctx,
+			Fork(
+				count,
+				func(ctx context.Context) error {
+					m.Lock()
+					defer m.Unlock()
+					names = append(names, Name(ctx))
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+
+		slices.Sort(names)
+
+		for i, name := range names {
+			prefix, suffix, ok := strings.Cut(name, "#")
+			if !ok || suffix != fmt.Sprint(i) {
+				t.Fatalf("unexpected name: got %q, want a suffix of #%d", name, i)
+			}
+
+			if !strings.HasPrefix(prefix, "github.com/dogmatiq/minibus_test.TestRun_orchestration.") {
+				t.Fatalf("unexpected name: got %q, want the name of the Go function", name)
+			}
+		}
+
+		if len(names) != count {
+			t.Fatalf("unexpected number of functions: got %d, want %d", len(names), count)
+		}
+	})
+
+	t.Run("it includes the function's name in the trace log", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := trace.Start(&buf); err != nil {
+			t.Skipf("unable to start trace: %s", err)
+		}
+
+		err := Run(
+			context.Background(),
+			WithNamedFunc(
+				"<name>",
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return nil
+				},
+			),
+		)
+
+		trace.Stop()
+
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+
+		if !bytes.Contains(buf.Bytes(), []byte("<name>: ready")) {
+			t.Fatal("expected the trace log to include the function's name")
+		}
+	})
+
+	t.Run("it logs lifecycle events to the logger", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		h := &recordingHandler{}
+
+		err := Run(
+			ctx,
+			WithLogger(slog.New(h)),
+			WithNamedFunc(
+				"<name>",
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+
+		want := []string{
+			"started function=<name>",
+			"subscribed function=<name> message_type=int",
+			"ready function=<name> subscriptions=1",
+			"returned function=<name>",
+		}
+
+		if got := h.Records(); !slices.Equal(got, want) {
+			t.Fatalf("unexpected log records: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("it does not log events below the level configured by WithLogLevel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		h := &recordingHandler{}
+
+		err := Run(
+			ctx,
+			WithLogger(slog.New(h)),
+			WithLogLevel(slog.LevelDebug),
+			WithNamedFunc(
+				"<name>",
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+
+		want := []string{
+			"started function=<name>",
+			"ready function=<name> subscriptions=1",
+			"returned function=<name>",
+		}
+
+		if got := h.Records(); !slices.Equal(got, want) {
+			t.Fatalf("unexpected log records: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("it logs a warning for each function that is not ready within the threshold configured by WithSlowReadyThreshold", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		h := &recordingHandler{}
+
+		err := Run(
+			ctx,
+			WithLogger(slog.New(h)),
+			WithLogLevel(slog.LevelWarn),
+			WithSlowReadyThreshold(10*time.Millisecond),
+			WithNamedFunc(
+				"<ready>",
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return WaitReady(ctx)
+				},
+			),
+			WithNamedFunc(
+				"<slow>",
+				func(ctx context.Context) error {
+					time.Sleep(50 * time.Millisecond)
+					Ready(ctx)
+					return nil
+				},
+			),
+			WithNamedFunc(
+				"<returned>",
+				func(ctx context.Context) error {
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+
+		want := []string{
+			"not ready function=<slow> elapsed=10ms",
+		}
+
+		if got := h.Records(); !slices.Equal(got, want) {
+			t.Fatalf("unexpected log records: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("it logs and reports warnings reported by functions", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		h := &recordingHandler{}
+		warning := errors.New("<warning>")
+
+		var (
+			names    []string
+			warnings []error
+		)
+
+		err := Run(
+			ctx,
+			WithLogger(slog.New(h)),
+			WithLogLevel(slog.LevelWarn),
+			WithWarningHandler(
+				func(_ context.Context, name string, err error) {
+					names = append(names, name)
+					warnings = append(warnings, err)
+				},
+			),
+			WithNamedFunc(
+				"<name>",
+				func(ctx context.Context) error {
+					Ready(ctx)
+					Warn(ctx, warning)
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+
+		want := []string{"warning function=<name> error=<warning>"}
+		if got := h.Records(); !slices.Equal(got, want) {
+			t.Fatalf("unexpected log records: got %q, want %q", got, want)
+		}
+
+		if len(warnings) != 1 || warnings[0] != warning || names[0] != "<name>" {
+			t.Fatalf("unexpected warnings: got %v from %v, want [%v] from [<name>]", warnings, names, warning)
+		}
+	})
+
+	t.Run("it logs a warning for each declared output type that has no subscribers", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		h := &recordingHandler{}
+
+		err := Run(
+			ctx,
+			WithLogger(slog.New(h)),
+			WithNamedFunc(
+				"<publisher>",
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return WaitReady(ctx)
+				},
+				WithOutputTypes(
+					reflect.TypeFor[int](),
+					reflect.TypeFor[string](),
+				),
+			),
+			WithNamedFunc(
+				"<subscriber>",
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+					return WaitReady(ctx)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+
+		want := "published type has no subscribers function=<publisher> message_type=string"
+		if got := h.Records(); !slices.Contains(got, want) {
+			t.Fatalf("expected log record %q, got %q", want, got)
+		}
+
+		for _, r := range h.Records() {
+			if strings.Contains(r, "message_type=int") && strings.HasPrefix(r, "published") {
+				t.Fatalf("unexpected log record: %q", r)
+			}
+		}
+	})
+
+	t.Run("it logs a warning for each subscribed type that is not published when WithStrictPublications is used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		h := &recordingHandler{}
+
+		err := Run(
+			ctx,
+			WithLogger(slog.New(h)),
+			WithStrictPublications(),
+			WithNamedFunc(
+				"<publisher>",
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return WaitReady(ctx)
+				},
+				WithOutputTypes(reflect.TypeFor[int]()),
+			),
+			WithNamedFunc(
+				"<subscriber>",
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Subscribe[string](ctx)
+					Ready(ctx)
+					return WaitReady(ctx)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+
+		want := "subscribed type is not published function=<subscriber> message_type=string"
+		if got := h.Records(); !slices.Contains(got, want) {
+			t.Fatalf("expected log record %q, got %q", want, got)
+		}
+
+		for _, r := range h.Records() {
+			if strings.Contains(r, "message_type=int") && strings.HasPrefix(r, "subscribed type") {
+				t.Fatalf("unexpected log record: %q", r)
+			}
+		}
+	})
+
+	t.Run("it returns ErrNoSubscribers if a declared output type has no subscribers when WithRequireSubscribers is used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithRequireSubscribers(),
+			WithFunc(
+				func(ctx context.Context) error {
+					Publish[string](ctx)
+					Ready(ctx)
+					return WaitReady(ctx)
+				},
+				WithOutputTypes(reflect.TypeFor[int]()),
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+					return WaitReady(ctx)
+				},
+			),
+		)
+		if !errors.Is(err, ErrNoSubscribers) {
+			t.Fatalf("unexpected error: got %v, want %v", err, ErrNoSubscribers)
+		}
+
+		if !strings.Contains(err.Error(), "string") || strings.Contains(err.Error(), "int") {
+			t.Fatalf("unexpected error message: %q", err)
+		}
+	})
+
+	t.Run("it exchanges messages if every declared output type has subscribers when WithRequireSubscribers is used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithRequireSubscribers(),
+			WithFunc(
+				func(ctx context.Context) error {
+					Publish[int](ctx)
+					Ready(ctx)
+					return Send(ctx, 123)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+	})
+
+	t.Run("it exchanges messages without waiting for functions that use WithLateJoin", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		exchanged := make(chan struct{})
+		var received []any
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					for range 2 {
+						m, err := Receive(ctx)
+						if err != nil {
+							return err
+						}
+
+						received = append(received, m)
+						if len(received) == 1 {
+							close(exchanged)
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, 1)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-exchanged:
+					}
+
+					Ready(ctx)
+					return Send(ctx, "<late>")
+				},
+				WithLateJoin(),
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if want := []any{1, "<late>"}; !slices.Equal(received, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", received, want)
+		}
+	})
+
+	t.Run("it starts the functions in batches when WithStagedStart is used", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const functions, batch = 7, 3
+
+		// readied is the number of functions that have called Ready, or
+		// returned without doing so.
+		var readied atomic.Int64
+		options := []Option{WithStagedStart(batch)}
+
+		for i := range functions {
+			options = append(
+				options,
+				WithFunc(
+					func(ctx context.Context) error {
+						if n, want := readied.Load(), int64(i/batch*batch); n < want {
+							t.Errorf("function %d started before the previous batch was ready: got %d ready, want at least %d", i, n, want)
+						}
+
+						// The second function returns without calling Ready,
+						// which must not prevent the next batch from starting.
+						if i == 1 {
+							readied.Add(1)
+							return nil
+						}
+
+						Subscribe[int](ctx)
+						readied.Add(1)
+						Ready(ctx)
+
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+
+						// Every message is received, as none of the functions
+						// exchange messages until all of them are ready.
+						for range functions - 2 {
+							if _, err := Receive(ctx); err != nil {
+								return err
+							}
+						}
+
+						return nil
+					},
+				),
+			)
+		}
+
+		if err := Run(ctx, options...); err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it executes functions spawned by other functions", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received int
+
+		spawned := func(ctx context.Context) error {
+			Subscribe[int](ctx)
+			Ready(ctx)
+
+			if err := Send(ctx, "<ready>"); err != nil {
+				return err
+			}
+
+			m, err := ReceiveAs[int](ctx)
+			received = m
+			return err
+		}
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					if err := Spawn(ctx, spawned); err != nil {
+						return err
+					}
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+
+					return Send(ctx, 42)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+
+		if received != 42 {
+			t.Fatalf("unexpected message received by spawned function: got %d, want 42", received)
+		}
+	})
+
+	t.Run("it delivers in-flight messages during the drain timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received []int
+		stop := errors.New("<stop>")
+
+		err := Run(
+			ctx,
+			WithDrainTimeout(500*time.Millisecond),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					// Keep reading after the context is canceled, until the
+					// inbox is closed.
+					for m := range Inbox(ctx) {
+						time.Sleep(10 * time.Millisecond)
+						received = append(received, m.(int))
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range 3 {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					// The last message is still being delivered when this
+					// function returns and the session begins to shut down.
+					return stop
+				},
+			),
+		)
+
+		if err != stop {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, stop)
+		}
+
+		if want := []int{0, 1, 2}; !slices.Equal(received, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", received, want)
+		}
+	})
+
+	t.Run("it delivers messages of a type that has already been sent to a function that subscribes to an interface later", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received any
+
+		spawned := func(ctx context.Context) error {
+			Subscribe[io.Reader](ctx)
+			Ready(ctx)
+
+			if err := Send(ctx, "<ready>"); err != nil {
+				return err
+			}
+
+			m, err := Receive(ctx)
+			received = m
+			return err
+		}
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					// Send a message before there are any subscribers to its
+					// type, so that its subscribers are finalized.
+					if err := SendSync(ctx, &reader{"<first>"}); err != nil {
+						return err
+					}
+
+					if err := Spawn(ctx, spawned); err != nil {
+						return err
+					}
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+
+					return Send(ctx, &reader{"<second>"})
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+
+		if r, ok := received.(*reader); !ok || r.Name != "<second>" {
+			t.Fatalf("unexpected message received by spawned function: got %v, want <second>", received)
+		}
+	})
+
+	t.Run("it unblocks WaitReady only after all functions are ready", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var isLastReady atomic.Bool
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := WaitReady(ctx); err != nil {
+						return err
+					}
+
+					if !isLastReady.Load() {
+						return errors.New("WaitReady() returned before all functions were ready")
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					time.Sleep(20 * time.Millisecond)
+					isLastReady.Store(true)
+					Ready(ctx)
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+	})
+
+	t.Run("it delivers messages to subscribers in the order they were added when deterministic ordering is enabled", func(t *testing.T) {
+		for range 5 {
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			const count = 3
+			var receiving [count]atomic.Bool
+
+			// Each subscriber checks that those added before it had already
+			// started receiving before it received the message. The earlier
+			// subscribers are slower to start, so the check would fail if
+			// the message were delivered concurrently.
+			subscriber := func(i int) Func {
+				return func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					time.Sleep(time.Duration(count-i) * 10 * time.Millisecond)
+					receiving[i].Store(true)
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+
+					for j := range i {
+						if !receiving[j].Load() {
+							return fmt.Errorf("subscriber %d received the message before subscriber %d", i, j)
+						}
+					}
+
+					return nil
+				}
+			}
+
+			options := []Option{
+				WithDeterministicOrder(),
+				WithFunc(
+					func(ctx context.Context) error {
+						Ready(ctx)
+						return Send(ctx, "<message>")
+					},
+				),
+			}
+
+			for i := range count {
+				options = append(options, WithFunc(subscriber(i)))
+			}
+
+			if err := Run(ctx, options...); err != nil {
+				t.Fatalf("Run() returned an unexpected error: %q", err)
+			}
+		}
+	})
+
+	t.Run("it returns ErrDeadlock when all functions are blocked receiving", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		waitForever := func(ctx context.Context) error {
+			Subscribe[string](ctx)
+			Ready(ctx)
+
+			_, err := Receive(ctx)
+			return err
+		}
+
+		err := Run(
+			ctx,
+			WithDeadlockDetection(),
+			WithFunc(waitForever),
+			WithFunc(waitForever),
+		)
+		if err != ErrDeadlock {
+			t.Fatalf("unexpected error: got %v, want %q", err, ErrDeadlock)
+		}
+	})
+
+	t.Run("it returns ErrDeadlock when the remaining functions are blocked receiving after another returns", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithDeadlockDetection(),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					for {
+						if _, err := Receive(ctx); err != nil {
+							return err
+						}
+					}
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, "<message>")
+				},
+			),
+		)
+		if err != ErrDeadlock {
+			t.Fatalf("unexpected error: got %v, want %q", err, ErrDeadlock)
+		}
+	})
+
+	t.Run("it does not report a deadlock while messages are in flight", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const rounds = 1000
+
+		pingPong := func(first bool) Func {
+			return func(ctx context.Context) error {
+				if first {
+					Subscribe[int](ctx)
+				} else {
+					Subscribe[string](ctx)
+				}
+				Ready(ctx)
+
+				for i := range rounds {
+					if first {
+						if err := Send(ctx, "<ping>"); err != nil {
+							return err
+						}
+					}
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+
+					if !first {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+				}
+
+				return nil
+			}
+		}
+
+		err := Run(
+			ctx,
+			WithDeadlockDetection(),
+			WithInboxBuffer(1),
+			WithFunc(pingPong(true)),
+			WithFunc(pingPong(false)),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it returns the number of other running functions from Peers", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const workers = 3
+
+		var stops [workers]chan struct{}
+		for i := range stops {
+			stops[i] = make(chan struct{})
+		}
+
+		options := []Option{
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if n := Peers(ctx); n != workers {
+						return fmt.Errorf("unexpected number of peers: got %d, want %d", n, workers)
+					}
+
+					// Stop each worker in turn, and wait for the number of
+					// peers to decrease.
+					for i, stop := range stops {
+						close(stop)
+
+						for Peers(ctx) != workers-i-1 {
+							select {
+							case <-ctx.Done():
+								return ctx.Err()
+							case <-time.After(time.Millisecond):
+							}
+						}
+					}
+
+					return nil
+				},
+			),
+		}
+
+		for _, stop := range stops {
+			options = append(
+				options,
+				WithFunc(
+					func(ctx context.Context) error {
+						Ready(ctx)
+						<-stop
+						return nil
+					},
+				),
+			)
+		}
+
+		if err := Run(ctx, options...); err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it allows a function to stop without shutting down the session", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const rounds = 10
+
+		stopped := make(chan struct{})
+		var stoppedErr error
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					Stop(ctx)
+					close(stopped)
+
+					_, stoppedErr = Receive(ctx)
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-stopped:
+					}
+
+					for range rounds {
+						if err := SendSync(ctx, "<ping>"); err != nil {
+							return err
+						}
+
+						if _, err := Receive(ctx); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					for i := range rounds {
+						if _, err := Receive(ctx); err != nil {
+							return err
+						}
+
+						if err := SendSync(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if stoppedErr != ErrInboxClosed {
+			t.Fatalf("unexpected error from Receive() after Stop(): got %v, want %q", stoppedErr, ErrInboxClosed)
+		}
+	})
+
+	t.Run("it waits for all functions to be ready when a function returns after calling Ready", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		returned := make(chan struct{})
+		sending := make(chan struct{})
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					defer close(returned)
+					Ready(ctx)
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					// Subscribe late, so that the other functions have already
+					// signaled readiness, and one of them has returned.
+					for _, latch := range []chan struct{}{returned, sending} {
+						select {
+						case <-ctx.Done():
+							return ctx.Err()
+						case <-latch:
+						}
+					}
+
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					close(sending)
+					return Send(ctx, "<message>")
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it drops every pending delivery at once when there are thousands of them", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		const senders, receivers = 2, 1000
+
+		session, stop := context.WithCancel(ctx)
+		defer stop()
+
+		before := runtime.NumGoroutine()
+		stats := &recordingStats{}
+
+		err := Run(
+			session,
+			append(
+				withPendingDeliveries(senders, receivers, stop),
+				WithStats(stats),
+			)...,
+		)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("unexpected error: got %v, want %v", err, context.Canceled)
+		}
+
+		want := map[reflect.Type]int{
+			reflect.TypeFor[string](): senders * receivers,
+		}
+
+		if !maps.Equal(stats.Dropped, want) {
+			t.Fatalf("unexpected dropped messages: got %v, want %v", stats.Dropped, want)
+		}
+
+		if len(stats.Delivered) != 0 {
+			t.Fatalf("unexpected delivered messages: got %v, want none", stats.Delivered)
+		}
+
+		if after := runtime.NumGoroutine(); after != before {
+			t.Fatalf("unexpected number of goroutines after Run() returned: got %d, want %d", after, before)
+		}
+	})
+}
+
+func BenchmarkRun_startup(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		b.Run(fmt.Sprintf("%d functions", n), func(b *testing.B) {
+			b.ReportAllocs()
+
+			fork := Fork(
+				n,
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+					return nil
+				},
+			)
+
+			for range b.N {
+				if err := Run(context.Background(), fork); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRun_stagedStartup(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		for _, batch := range []int{10, 100, 1000} {
+			b.Run(fmt.Sprintf("%d functions in batches of %d", n, batch), func(b *testing.B) {
+				b.ReportAllocs()
+
+				fork := Fork(
+					n,
+					func(ctx context.Context) error {
+						Subscribe[int](ctx)
+						Ready(ctx)
+						return nil
+					},
+				)
+
+				for range b.N {
+					if err := Run(context.Background(), WithStagedStart(batch), fork); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkRun_shutdown(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("%d pending deliveries", n), func(b *testing.B) {
+			var latency time.Duration
+
+			for range b.N {
+				ctx, cancel := context.WithCancel(context.Background())
+				var stopped time.Time
+
+				err := Run(
+					ctx,
+					withPendingDeliveries(
+						1,
+						n,
+						func() {
+							stopped = time.Now()
+							cancel()
+						},
+					)...,
+				)
+				latency += time.Since(stopped)
+
+				if !errors.Is(err, context.Canceled) {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(latency.Nanoseconds())/float64(b.N), "ns/shutdown")
+		})
+	}
+}
+
+// withPendingDeliveries returns the options for a session in which each of
+// the senders sends a message to all of the receivers, none of which ever
+// receive it. stop is called once every delivery is pending.
+func withPendingDeliveries(senders, receivers int, stop func()) []Option {
+	var pending atomic.Int64
+	blocked := make(chan struct{})
+
+	return []Option{
+		// Each delivery is reported as slow once it has been pending for
+		// the threshold.
+		WithSlowSubscriberThreshold(
+			time.Millisecond,
+			func(context.Context, string, reflect.Type) {
+				if pending.Add(1) == int64(senders*receivers) {
+					close(blocked)
+				}
+			},
+		),
+		Fork(
+			senders,
+			func(ctx context.Context) error {
+				Ready(ctx)
+				return Send(ctx, "<message>")
+			},
+		),
+		Fork(
+			receivers,
+			func(ctx context.Context) error {
+				Subscribe[string](ctx)
+				Ready(ctx)
+				<-ctx.Done()
+				return nil
+			},
+		),
+		WithFunc(
+			func(ctx context.Context) error {
+				Ready(ctx)
+
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-blocked:
+					stop()
+					return nil
+				}
+			},
+		),
+	}
+}
+
+// recordingHandler is a [slog.Handler] that records a summary of each record.
+type recordingHandler struct {
+	m       sync.Mutex
+	records []string
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	s := r.Message
+	r.Attrs(func(attr slog.Attr) bool {
+		s += " " + attr.String()
+		return true
+	})
+
+	h.m.Lock()
+	h.records = append(h.records, s)
+	h.m.Unlock()
+
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler {
+	panic("not implemented")
+}
+
+func (h *recordingHandler) WithGroup(string) slog.Handler {
+	panic("not implemented")
+}
+
+func (h *recordingHandler) Records() []string {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return slices.Clone(h.records)
 }
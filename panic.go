@@ -0,0 +1,59 @@
+package minibus
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error returned by [Run] when one of its functions panics.
+type PanicError struct {
+	value any
+	stack []byte
+}
+
+// Value returns the value that was passed to panic().
+func (e *PanicError) Value() any {
+	return e.value
+}
+
+// Stack returns the stack trace of the goroutine that panicked, as captured
+// when the panic was recovered.
+func (e *PanicError) Stack() []byte {
+	return e.stack
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("minibus: function panicked: %v", e.value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.value.(error)
+	return err
+}
+
+// PanicPolicy determines how [Run] responds when one of its functions panics.
+type PanicPolicy int
+
+const (
+	// FailSession is a [PanicPolicy] that treats a panic as though the function
+	// returned a [*PanicError], causing the session to shut down. It is the
+	// default policy.
+	FailSession PanicPolicy = iota
+
+	// IsolateFunction is a [PanicPolicy] that removes a panicking function from
+	// the session, as though it had returned without error, leaving the other
+	// functions running. The panic is logged, and reported to any [Stats] as a
+	// [*PanicError].
+	IsolateFunction
+)
+
+// recoverPanic converts a recovered panic value into a [PanicError].
+func recoverPanic(err *error) {
+	if v := recover(); v != nil {
+		*err = &PanicError{
+			value: v,
+			stack: debug.Stack(),
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package minibus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ErrSendTimeout is returned by [Send] and its variants when the message is not
+// accepted for delivery within the timeout set by [WithDeliveryPolicy].
+var ErrSendTimeout = errors.New("minibus: timed out waiting for the message to be accepted")
+
+// DeliveryPolicy determines how [Send] and its variants behave when a message
+// can't be accepted for delivery straight away. See [WithDeliveryPolicy].
+//
+// The zero value is the default policy. Send waits for as long as it takes the
+// sender's outbox to accept the message, and a message that exceeds the limit
+// set by [WithMaxQueueDepth] is rejected with [ErrQueueFull].
+type DeliveryPolicy struct {
+	// Overflow determines what happens to a message that is sent once the
+	// limit set by [WithMaxQueueDepth] for its type has been reached. It has
+	// no effect on types without a limit.
+	Overflow OverflowPolicy
+
+	// Timeout, if positive, is the maximum time that Send waits for the
+	// message to be accepted, including the time spent waiting for space
+	// under the [BlockWhenFull] policy and for space in the sender's outbox.
+	// Once it elapses, Send returns [ErrSendTimeout].
+	Timeout time.Duration
+}
+
+// OverflowPolicy determines what [Send] does with a message once the limit
+// set by [WithMaxQueueDepth] for its type has been reached.
+type OverflowPolicy int
+
+const (
+	// RejectWhenFull is an [OverflowPolicy] that causes Send to return an
+	// error that wraps [ErrQueueFull]. It is the default policy.
+	RejectWhenFull OverflowPolicy = iota
+
+	// BlockWhenFull is an [OverflowPolicy] that causes Send to wait until a
+	// recipient receives an earlier message of the same type, making space for
+	// the new message.
+	BlockWhenFull
+
+	// DropWhenFull is an [OverflowPolicy] that causes Send to discard the
+	// message and return nil. The message is reported as dropped to any
+	// [Stats] and event sink.
+	DropWhenFull
+)
+
+// reserve reserves space for a message of type t in depth, as per the
+// session's [DeliveryPolicy]. It returns false if the message is dropped.
+//
+// expired, if non-nil, receives a value when the policy's timeout elapses.
+func (f *function) reserve(
+	ctx context.Context,
+	depth *queueDepth,
+	t reflect.Type,
+	expired <-chan time.Time,
+) (bool, error) {
+	for {
+		// Obtain the channel before checking the depth, so that space
+		// released in between is not missed.
+		released := depth.Released()
+
+		if depth.TryAdd() {
+			return true, nil
+		}
+
+		switch f.Config.DeliveryPolicy.Overflow {
+		case DropWhenFull:
+			f.Config.Stats.MessageDropped(f.Name, t)
+			f.emit(MessageDropped{t})
+			return false, nil
+		case BlockWhenFull:
+		default:
+			return false, fmt.Errorf("%w: %s", ErrQueueFull, t)
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-f.OutboxLatch:
+			return false, ErrOutboxClosed
+		case <-expired:
+			return false, ErrSendTimeout
+		case <-released:
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package minibus_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestWithDeliveryPolicy(t *testing.T) {
+	t.Run("it waits for space under the BlockWhenFull policy", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithMaxQueueDepth[int](1),
+			WithDeliveryPolicy(DeliveryPolicy{Overflow: BlockWhenFull}),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					for want := range 10 {
+						m, err := ReceiveAs[int](ctx)
+						if err != nil {
+							return err
+						}
+						if m != want {
+							return fmt.Errorf("unexpected message: got %d, want %d", m, want)
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for m := range 10 {
+						if err := Send(ctx, m); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it discards messages under the DropWhenFull policy", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		events := make(chan Event, 100)
+		sent := make(chan struct{})
+
+		err := Run(
+			ctx,
+			WithMaxQueueDepth[int](1),
+			WithDeliveryPolicy(DeliveryPolicy{Overflow: DropWhenFull}),
+			WithEventSink(events),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-sent:
+					}
+
+					m, err := ReceiveAs[int](ctx)
+					if err != nil {
+						return err
+					}
+					if m != 1 {
+						return fmt.Errorf("unexpected message: got %d, want %d", m, 1)
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					defer close(sent)
+
+					for _, m := range []int{1, 2, 3} {
+						if err := Send(ctx, m); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		close(events)
+
+		dropped := 0
+		for e := range events {
+			if e, ok := e.(MessageDropped); ok && e.Type == reflect.TypeFor[int]() {
+				dropped++
+			}
+		}
+
+		if dropped != 2 {
+			t.Fatalf("unexpected number of dropped messages: got %d, want %d", dropped, 2)
+		}
+	})
+
+	t.Run("it returns ErrSendTimeout if there is no space before the timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		sent := make(chan struct{})
+
+		err := Run(
+			ctx,
+			WithMaxQueueDepth[int](1),
+			WithDeliveryPolicy(
+				DeliveryPolicy{
+					Overflow: BlockWhenFull,
+					Timeout:  10 * time.Millisecond,
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-sent:
+					}
+
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					defer close(sent)
+
+					if err := Send(ctx, 1); err != nil {
+						return err
+					}
+
+					if err := Send(ctx, 2); err != ErrSendTimeout {
+						return fmt.Errorf("unexpected error: got %v, want %q", err, ErrSendTimeout)
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it returns ErrSendTimeout if the outbox does not accept the message before the timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		sent := make(chan struct{})
+
+		err := Run(
+			ctx,
+			WithDeliveryPolicy(DeliveryPolicy{Timeout: 10 * time.Millisecond}),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-sent:
+					}
+
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					defer close(sent)
+
+					// The first message is accepted by the outbox, but it can
+					// not be delivered until the recipient receives it, so the
+					// outbox can not accept the second.
+					if err := Send(ctx, 1); err != nil {
+						return err
+					}
+
+					if err := Send(ctx, 2); err != ErrSendTimeout {
+						return fmt.Errorf("unexpected error: got %v, want %q", err, ErrSendTimeout)
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it panics if the policy is invalid", func(t *testing.T) {
+		cases := []DeliveryPolicy{
+			{Overflow: -1},
+			{Overflow: DropWhenFull + 1},
+			{Timeout: -1},
+		}
+
+		for _, p := range cases {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Fatalf("expected a panic for %+v", p)
+					}
+				}()
+
+				WithDeliveryPolicy(p)
+			}()
+		}
+	})
+}
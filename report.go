@@ -0,0 +1,141 @@
+package minibus
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Report is a summary of the functions executed by a call to [Run] and the
+// messages they exchanged, as per [WithReport].
+type Report struct {
+	// Functions is the number of functions that were started, including those
+	// started by [Spawn].
+	Functions int
+
+	// Sent is the number of messages sent, keyed by the type used to route
+	// them.
+	Sent map[reflect.Type]int
+
+	// Delivered is the number of messages placed in a recipient's inbox, keyed
+	// by the type used to route them. A message with several recipients is
+	// counted once per recipient.
+	Delivered map[reflect.Type]int
+
+	// Funcs is a summary of the messages exchanged by each function, keyed by
+	// the function's name. Functions with the same name are summarized
+	// together.
+	Funcs map[string]FuncReport
+}
+
+// FuncReport is a summary of the messages exchanged by a single function, as
+// part of a [Report].
+type FuncReport struct {
+	// Sent is the number of messages that the function sent.
+	Sent int
+
+	// Received is the number of messages that the function received from its
+	// inbox.
+	Received int
+
+	// Handling is the total time that the function spent handling messages,
+	// as per [Stats].
+	Handling time.Duration
+}
+
+// WithReport is an [Option] that populates r with a [Report] of the session.
+//
+// r is reset when [Run] starts, and is complete once Run returns, even if Run
+// returns an error. It must not be read while Run is running. It may be used
+// with the [WithStats] option, in which case the statistics are reported to
+// both.
+func WithReport(r *Report) Option {
+	if r == nil {
+		panic("minibus: WithReport() must not be called with a nil Report")
+	}
+
+	return func(cfg *config) {
+		cfg.Report = r
+	}
+}
+
+// newReportStats returns a [reportStats] that resets r and builds a report in
+// it, forwarding the statistics to next.
+func newReportStats(r *Report, next Stats) *reportStats {
+	*r = Report{
+		Sent:      map[reflect.Type]int{},
+		Delivered: map[reflect.Type]int{},
+		Funcs:     map[string]FuncReport{},
+	}
+
+	return &reportStats{
+		Next:   next,
+		Report: r,
+	}
+}
+
+// reportStats is a [Stats] implementation that builds a [Report], and forwards
+// the statistics to the next implementation.
+type reportStats struct {
+	Next Stats
+
+	m      sync.Mutex
+	Report *Report
+}
+
+func (s *reportStats) FuncStarted(fn string) {
+	s.m.Lock()
+	s.Report.Functions++
+	s.m.Unlock()
+
+	s.Next.FuncStarted(fn)
+}
+
+func (s *reportStats) FuncReturned(fn string, err error) {
+	s.Next.FuncReturned(fn, err)
+}
+
+func (s *reportStats) MessageSent(fn string, t reflect.Type) {
+	s.m.Lock()
+	s.Report.Sent[t]++
+	s.updateFunc(fn, func(r *FuncReport) { r.Sent++ })
+	s.m.Unlock()
+
+	s.Next.MessageSent(fn, t)
+}
+
+func (s *reportStats) MessageDelivered(fn string, t reflect.Type, latency time.Duration) {
+	s.m.Lock()
+	s.Report.Delivered[t]++
+	s.m.Unlock()
+
+	s.Next.MessageDelivered(fn, t, latency)
+}
+
+func (s *reportStats) MessageReceived(fn string, t reflect.Type) {
+	s.m.Lock()
+	s.updateFunc(fn, func(r *FuncReport) { r.Received++ })
+	s.m.Unlock()
+
+	s.Next.MessageReceived(fn, t)
+}
+
+func (s *reportStats) MessageHandled(fn string, t reflect.Type, d time.Duration) {
+	s.m.Lock()
+	s.updateFunc(fn, func(r *FuncReport) { r.Handling += d })
+	s.m.Unlock()
+
+	s.Next.MessageHandled(fn, t, d)
+}
+
+func (s *reportStats) MessageDropped(fn string, t reflect.Type) {
+	s.Next.MessageDropped(fn, t)
+}
+
+// updateFunc applies update to the report of the function named fn. s.m must
+// be locked.
+func (s *reportStats) updateFunc(fn string, update func(*FuncReport)) {
+	r := s.Report.Funcs[fn]
+	update(&r)
+	s.Report.Funcs[fn] = r
+}
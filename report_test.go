@@ -0,0 +1,132 @@
+package minibus_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestWithReport(t *testing.T) {
+	t.Run("it reports the functions and messages in the session", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var report Report
+
+		err := Run(
+			ctx,
+			WithReport(&report),
+			Fork(
+				2,
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					for range 2 {
+						if _, err := Receive(ctx); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := Broadcast(ctx, "<message-1>", "<message-2>"); err != nil {
+						return err
+					}
+
+					return SendSync(ctx, 42)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		intType := reflect.TypeFor[int]()
+		stringType := reflect.TypeFor[string]()
+
+		if report.Functions != 3 {
+			t.Fatalf("unexpected number of functions: got %d, want 3", report.Functions)
+		}
+
+		if n := report.Sent[stringType]; n != 2 {
+			t.Fatalf("unexpected number of sent string messages: got %d, want 2", n)
+		}
+
+		if n := report.Sent[intType]; n != 1 {
+			t.Fatalf("unexpected number of sent int messages: got %d, want 1", n)
+		}
+
+		if n := report.Delivered[stringType]; n != 4 {
+			t.Fatalf("unexpected number of delivered string messages: got %d, want 4", n)
+		}
+
+		if n := report.Delivered[intType]; n != 0 {
+			t.Fatalf("unexpected number of delivered int messages: got %d, want 0", n)
+		}
+
+		if n := len(report.Funcs); n != 3 {
+			t.Fatalf("unexpected number of function reports: got %d, want 3", n)
+		}
+
+		var sent, received int
+		for _, r := range report.Funcs {
+			sent += r.Sent
+			received += r.Received
+		}
+
+		if sent != 3 {
+			t.Fatalf("unexpected number of messages sent by the functions: got %d, want 3", sent)
+		}
+
+		if received != 4 {
+			t.Fatalf("unexpected number of messages received by the functions: got %d, want 4", received)
+		}
+	})
+
+	t.Run("it reports statistics to the Stats passed to WithStats", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		stats := &recordingStats{}
+
+		var report Report
+
+		err := Run(
+			ctx,
+			WithReport(&report),
+			WithStats(stats),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return SendSync(ctx, "<message>")
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		stringType := reflect.TypeFor[string]()
+
+		if len(stats.Started) != 1 || report.Functions != 1 {
+			t.Fatalf("unexpected number of started functions: got %d and %d, want 1", len(stats.Started), report.Functions)
+		}
+
+		if n := stats.Sent[stringType]; n != 1 {
+			t.Fatalf("unexpected number of sent string messages: got %d, want 1", n)
+		}
+
+		if n := stats.Dropped[stringType]; n != 1 {
+			t.Fatalf("unexpected number of dropped string messages: got %d, want 1", n)
+		}
+	})
+}
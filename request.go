@@ -0,0 +1,154 @@
+package minibus
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+// Request sends a request message of type Req and waits for a reply of type
+// Res.
+//
+// The request is routed according to Req, in the same way as [SendAs]. The
+// functions that receive it may call [Reply] to send a reply directly back to
+// the calling function. The reply does not pass through the calling function's
+// inbox, and it does not need to subscribe to Res.
+//
+// If there are several responders, the first reply wins and any others are
+// discarded. If no reply arrives, Request blocks until ctx is canceled, so ctx
+// should usually have a deadline.
+//
+// It returns an error if the reply is not assignable to Res.
+func Request[Req, Res any](ctx context.Context, req Req) (Res, error) {
+	f := caller(ctx)
+
+	id, replies := f.BeginRequest()
+	defer f.EndRequest(id)
+
+	var zero Res
+
+	if err := Send(
+		ctx,
+		envelope{
+			Type:          reflect.TypeFor[Req](),
+			Message:       req,
+			CorrelationID: id,
+		},
+	); err != nil {
+		return zero, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case env := <-replies:
+		return as[Res](env.Message)
+	}
+}
+
+// SendAwait sends req, then waits for the next message of type Res that is sent
+// by any function, and returns it.
+//
+// Unlike [Request], the responder does not need to call [Reply]; it replies by
+// sending an ordinary message of type Res. The calling function is temporarily
+// subscribed to Res until the first such message arrives, which is returned
+// directly rather than via the calling function's inbox. Messages of type Res
+// sent by the calling function itself, including req, are never treated as the
+// reply, so req and the reply may be of the same type. If there are several
+// responders, the first reply wins and any others are discarded. A message of
+// type Res sent by another function at the same time is indistinguishable from
+// a reply, so SendAwait suits one-to-one flows with a single responder. If no
+// reply arrives, SendAwait blocks until ctx is canceled, so ctx should usually
+// have a deadline.
+//
+// The reply is treated as the message most recently received by the calling
+// function, so [Sender] identifies the responder. If the calling function
+// also subscribes to Res, the reply is also delivered to its inbox as usual.
+func SendAwait[Res any](ctx context.Context, req any) (Res, error) {
+	f := caller(ctx)
+
+	replies := f.awaiter()
+	defer close(replies.ReturnLatch)
+	defer f.Subscriptions.Remove(replies)
+
+	f.Subscriptions.Add(replies, reflect.TypeFor[Res](), nil)
+
+	// Retained messages were sent before the request, so they're not replies.
+	for _, env := range f.Subscriptions.Replays(replies) {
+		replies.drop(env)
+	}
+
+	var zero Res
+
+	if err := Send(ctx, req); err != nil {
+		return zero, err
+	}
+
+	receiving := f.beginReceive(ctx)
+	defer f.endReceive(receiving)
+
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case env := <-replies.Inbox:
+		return as[Res](f.Receive(env))
+	}
+}
+
+// awaiter returns a temporary function that receives messages on behalf of f,
+// as used by [SendAwait]. Its inbox is unbuffered, so that messages are never
+// left in it once its ReturnLatch is closed.
+func (f *function) awaiter() *function {
+	return &function{
+		Index:         f.Index,
+		Name:          f.Name,
+		Config:        f.Config,
+		Owner:         f,
+		Deadlock:      f.Deadlock,
+		SessionDone:   f.SessionDone,
+		Inbox:         make(chan envelope),
+		Subscriptions: f.Subscriptions,
+		ReturnLatch:   make(chan struct{}),
+		StopLatch:     make(chan struct{}),
+	}
+}
+
+// Reply sends res as the reply to the request message to, which must be the
+// message most recently received by the calling function.
+//
+// It returns an error if to was not sent using [Request], or if it is not the
+// most recently received message, or if ctx is canceled.
+func Reply(ctx context.Context, to, res any) error {
+	f := caller(ctx)
+
+	req, ok := f.Received()
+	if !ok || req.CorrelationID == 0 || !isSameMessage(req.Message, to) {
+		return errors.New("minibus: Reply() must be called with the request that was most recently received")
+	}
+
+	env := envelopeOf(res)
+	env.Recipient = req.Sender
+	env.CorrelationID = req.CorrelationID
+	env.IsReply = true
+
+	return Send(ctx, env)
+}
+
+// isSameMessage returns true if a and b are the same message, as far as can be
+// determined. Messages of different types are never the same, but messages
+// that can not be compared are assumed to be the same.
+func isSameMessage(a, b any) (same bool) {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+
+	// Comparing interface values panics if their dynamic type is not
+	// comparable, which can not always be determined ahead of time.
+	defer func() {
+		if recover() != nil {
+			same = true
+		}
+	}()
+
+	return a == b
+}
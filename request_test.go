@@ -0,0 +1,328 @@
+package minibus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestRequest(t *testing.T) {
+	t.Run("it returns the reply to the request", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					for {
+						m, err := ReceiveAs[int](ctx)
+						if err != nil {
+							return err
+						}
+
+						if err := Reply(ctx, m, m*10); err != nil {
+							return err
+						}
+					}
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					var (
+						g    sync.WaitGroup
+						errs = make([]error, 10)
+					)
+
+					for i := range errs {
+						g.Add(1)
+						go func() {
+							defer g.Done()
+
+							res, err := Request[int, int](ctx, i)
+							if err != nil {
+								errs[i] = err
+							} else if res != i*10 {
+								errs[i] = fmt.Errorf("unexpected reply to request %d: got %d, want %d", i, res, i*10)
+							}
+						}()
+					}
+
+					g.Wait()
+
+					if err := errors.Join(errs...); err != nil {
+						return err
+					}
+
+					return errors.New("<done>")
+				},
+			),
+		)
+
+		if err == nil || err.Error() != "<done>" {
+			t.Fatalf("Run() returned an unexpected error: %q", err)
+		}
+	})
+
+	t.Run("it returns an error if no reply arrives before the context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+					_, err := Receive(ctx)
+					<-ctx.Done()
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+					defer cancel()
+
+					_, err := Request[int, int](ctx, 42)
+					return err
+				},
+			),
+		)
+
+		if err != context.DeadlineExceeded {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("it returns an error if the reply is not assignable to the reply type", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					m, err := Receive(ctx)
+					if err != nil {
+						return err
+					}
+
+					if err := Reply(ctx, m, "<reply>"); err != nil {
+						return err
+					}
+
+					<-ctx.Done()
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					_, err := Request[int, int](ctx, 42)
+					return err
+				},
+			),
+		)
+
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestReply(t *testing.T) {
+	t.Run("it returns an error if the message was not a request", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					m, err := Receive(ctx)
+					if err != nil {
+						return err
+					}
+
+					return Reply(ctx, m, "<reply>")
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, 42)
+				},
+			),
+		)
+
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestSendAwait(t *testing.T) {
+	t.Run("it returns the first message of the reply type", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			Fork(
+				2,
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					m, err := ReceiveAs[int](ctx)
+					if err != nil {
+						return err
+					}
+
+					return Send(ctx, fmt.Sprintf("<reply-%d>", m))
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					res, err := SendAwait[string](ctx, 1)
+					if err != nil {
+						return err
+					}
+
+					if res != "<reply-1>" {
+						return fmt.Errorf("unexpected reply: got %q, want %q", res, "<reply-1>")
+					}
+
+					if _, ok := Sender(ctx); !ok {
+						return errors.New("expected the responder to be identified")
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it does not treat the request as the reply when they are of the same type", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					m, err := ReceiveAs[string](ctx)
+					if err != nil {
+						return err
+					}
+
+					if m != "ping" {
+						return fmt.Errorf("unexpected request: got %q, want %q", m, "ping")
+					}
+
+					return Send(ctx, "pong")
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					res, err := SendAwait[string](ctx, "ping")
+					if err != nil {
+						return err
+					}
+
+					if res != "pong" {
+						return fmt.Errorf("unexpected reply: got %q, want %q", res, "pong")
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it does not wait for its own messages of the reply type", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+					defer cancel()
+
+					res, err := SendAwait[string](ctx, "ping")
+					if err != context.DeadlineExceeded {
+						return fmt.Errorf("unexpected result: got (%q, %v), want %q", res, err, context.DeadlineExceeded)
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+
+	t.Run("it returns an error if no reply arrives before the context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+					defer cancel()
+
+					_, err := SendAwait[string](ctx, 1)
+					if err != context.DeadlineExceeded {
+						return fmt.Errorf("unexpected error: got %v, want %q", err, context.DeadlineExceeded)
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+}
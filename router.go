@@ -0,0 +1,62 @@
+package minibus
+
+import (
+	"context"
+	"reflect"
+)
+
+// Router dispatches the messages in a function's inbox to handlers based on
+// the message type.
+//
+// Handlers are registered using [On]. The function then calls
+// [Router.Subscribe] before [Ready], and [Router.Run] to consume its inbox.
+// The zero value is ready to use.
+type Router struct {
+	d dispatcher
+}
+
+// On registers a handler for messages of type M with r.
+//
+// If M is an interface, the handler is called for any message that implements
+// M, unless there is a handler for the message's concrete type. When a message
+// implements more than one such interface, the handler that was registered
+// first is used.
+//
+// It panics if a handler for M is already registered.
+func On[M any](r *Router, handler func(context.Context, M) error) {
+	r.d.Add(
+		reflect.TypeFor[M](),
+		func(ctx context.Context, m any) error {
+			v, _ := m.(M)
+			return handler(ctx, v)
+		},
+	)
+}
+
+// Default registers a handler for messages that do not match any of the
+// handlers registered with [On].
+//
+// By default, such messages are ignored. Only messages of types that have been
+// subscribed to are received, so the default handler is only called when the
+// function has subscribed to additional types, such as via [Subscribe].
+func (r *Router) Default(handler func(context.Context, any) error) {
+	r.d.Default = handler
+}
+
+// Subscribe subscribes the calling function to each of the message types that
+// have handlers registered with r.
+//
+// It may only be called within a function that has been called by [Run]. It
+// must be called before [Ready].
+func (r *Router) Subscribe(ctx context.Context) {
+	SubscribeAny(ctx, r.d.Types...)
+}
+
+// Run dispatches the messages in the calling function's inbox to the
+// registered handlers.
+//
+// It blocks until a handler returns a non-nil error, which it returns, or ctx
+// is canceled.
+func (r *Router) Run(ctx context.Context) error {
+	return r.d.Run(ctx)
+}
@@ -0,0 +1,84 @@
+package minibus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+type stringer struct{}
+
+func (stringer) String() string { return "<stringer>" }
+
+func TestRouter(t *testing.T) {
+	t.Run("it dispatches each message to the handler for its type", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var handled []string
+		done := errors.New("<done>")
+
+		var r Router
+
+		On(&r, func(_ context.Context, m string) error {
+			handled = append(handled, "string: "+m)
+			return nil
+		})
+
+		On(&r, func(_ context.Context, m fmt.Stringer) error {
+			handled = append(handled, "stringer: "+m.String())
+			return nil
+		})
+
+		r.Default(func(_ context.Context, m any) error {
+			handled = append(handled, fmt.Sprintf("default: %v", m))
+			return done
+		})
+
+		err := Run(
+			ctx,
+			WithFunc(
+				func(ctx context.Context) error {
+					r.Subscribe(ctx)
+					Subscribe[int](ctx)
+					Ready(ctx)
+					return r.Run(ctx)
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := Send(ctx, "<message>"); err != nil {
+						return err
+					}
+
+					if err := Send(ctx, stringer{}); err != nil {
+						return err
+					}
+
+					return Send(ctx, 42)
+				},
+			),
+		)
+
+		if err != done {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, done)
+		}
+
+		want := []string{
+			"string: <message>",
+			"stringer: <stringer>",
+			"default: 42",
+		}
+
+		if !slices.Equal(handled, want) {
+			t.Fatalf("unexpected handler calls: got %v, want %v", handled, want)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package minibus_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestWithRouting(t *testing.T) {
+	t.Run("it delivers each message to the subscribers selected by WithRouting", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var (
+			even, odd []int
+			names     [][]string
+		)
+
+		receive := func(out *[]int) Func {
+			return func(ctx context.Context) error {
+				Subscribe[int](ctx)
+				Ready(ctx)
+
+				for range 2 {
+					m, err := ReceiveAs[int](ctx)
+					if err != nil {
+						return err
+					}
+					*out = append(*out, m)
+				}
+
+				return nil
+			}
+		}
+
+		err := Run(
+			ctx,
+			WithRouting(
+				func(m any, subscribers []string) []string {
+					names = append(names, subscribers)
+
+					if m.(int)%2 == 0 {
+						return []string{"<even>"}
+					}
+					return []string{"<odd>"}
+				},
+			),
+			WithNamedFunc("<even>", receive(&even)),
+			WithNamedFunc("<odd>", receive(&odd)),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range 4 {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if want := []int{0, 2}; !slices.Equal(even, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", even, want)
+		}
+
+		if want := []int{1, 3}; !slices.Equal(odd, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", odd, want)
+		}
+
+		for _, n := range names {
+			if want := []string{"<even>", "<odd>"}; !slices.Equal(n, want) {
+				t.Fatalf("unexpected subscribers: got %v, want %v", n, want)
+			}
+		}
+	})
+}
@@ -2,7 +2,12 @@ package minibus
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Func is a function that can be executed by [Run].
@@ -12,25 +17,128 @@ type Func func(context.Context) error
 //
 // It blocks until all functions have returned, any single function returns an
 // error, or ctx is canceled. Functions are added using the [WithFunc] option.
+//
+// No message is lost when the session shuts down cleanly, that is, when all
+// functions return without error. Each message accepted by [Send] (or any of
+// its variants) is delivered to each of its recipients before [Run] returns,
+// including messages that are still buffered in the sender's outbox when the
+// sender returns or calls [CloseOutbox]. Only those recipients that return,
+// or call [Stop], before receiving the message miss it. There is no such
+// guarantee when the session shuts down because a function returns an error
+// or ctx is canceled; see [WithDrainTimeout].
+//
+// If a function panics, the panic is recovered and treated as though the
+// function returned a [*PanicError]. Use the [WithPanicPolicy] option to keep
+// the session running instead.
+//
+// By default it returns the first error returned by any function. Use the
+// [WithErrorAggregation] option to return the errors from all functions.
 func Run(
 	ctx context.Context,
-	functions ...Func,
+	options ...Option,
 ) (err error) {
+	cfg := config{
+		Stats:    noopStats{},
+		LogLevel: levelVerbose,
+		Clock:    systemClock{},
+	}
+
+	for _, opt := range options {
+		opt(&cfg)
+	}
+
+	if cfg.Report != nil {
+		cfg.Stats = newReportStats(cfg.Report, cfg.Stats)
+	}
+
+	parent := ctx
+	functions := cfg.Funcs
 	running := map[*function]struct{}{}
-	var pumps sync.WaitGroup
+	results := make([]error, 0, len(functions))
+	var calls, pumps sync.WaitGroup
+
+	// live is the number of functions that have been started but are yet to
+	// return. Unlike running, it's updated as soon as a function returns.
+	var live atomic.Int64
+
+	var deadlock *deadlockDetector
+	var deadlockSignal <-chan struct{}
+	if cfg.DetectDeadlock {
+		deadlock = &deadlockDetector{
+			Signal: make(chan struct{}, 1),
+		}
+		deadlockSignal = deadlock.Signal
+	}
 
 	subs := &subscriptions{}
-	readySignal := make(chan struct{}, len(functions))
+	var inspector *Inspector
+	if cfg.Inspect != nil {
+		inspector = &Inspector{subs: subs}
+		cfg.Inspect(inspector)
+	}
+
+	// batch is the number of functions that are started together. Only the
+	// functions in the current batch can be waiting to signal readiness.
+	batch := len(functions)
+	if cfg.StartBatch > 0 && cfg.StartBatch < batch {
+		batch = cfg.StartBatch
+	}
+
+	readySignal := make(chan *function, batch)
 	returnSignal := make(chan functionResult, len(functions))
+	readyLatch := make(chan struct{})
+	spawnSignal := make(chan funcConfig)
+	failSignal := make(chan error)
+	var failure error
+
+	// workers is the channel on which deliveries are passed to the pool of
+	// delivery goroutines, if any.
+	var workers chan delivery
+	if cfg.Workers > 0 {
+		workers = make(chan delivery)
+
+		for range cfg.Workers {
+			calls.Add(1)
+			go func() {
+				defer calls.Done()
+				for d := range workers {
+					d.Run()
+				}
+			}()
+		}
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
+
+	// deliveryCtx is the context used to deliver messages that the pumps have
+	// already read from the outboxes. It outlives ctx by up to the drain
+	// timeout, if any.
+	deliveryCtx, cancelDelivery := ctx, cancel
+	if cfg.DrainTimeout > 0 {
+		deliveryCtx, cancelDelivery = context.WithCancel(context.WithoutCancel(ctx))
+	}
+
 	defer func() {
 		// Cancel the context to signal functions AND message pumps to stop.
 		cancel()
 
+		// Give the message pumps a chance to finish delivering any messages
+		// that are already in flight.
+		if cfg.DrainTimeout > 0 {
+			drain := time.AfterFunc(cfg.DrainTimeout, cancelDelivery)
+			defer drain.Stop()
+		}
+
 		// Wait for the message pumps to finish so we can guarantee that there
 		// will be no more sends to any inboxes.
 		pumps.Wait()
+		cancelDelivery()
+
+		// Stop the delivery goroutines. There are no deliveries in progress
+		// once the pumps have finished.
+		if workers != nil {
+			close(workers)
+		}
 
 		// Close all of the inboxes to unblock functions that are readying from
 		// their inbox without selecting on the context.
@@ -42,52 +150,242 @@ func Run(
 		for len(running) > 0 {
 			r := <-returnSignal
 			delete(running, r.Func)
+			results[r.Func.Index] = r.Err
+		}
+
+		// Wait for the goroutines that called the functions to exit, so that
+		// Run never leaves any of its goroutines behind.
+		calls.Wait()
+
+		if cfg.AggregateErrors {
+			err = aggregateErrors(parent, ctx, failure, results)
 		}
 	}()
 
-	// Call each function in it's own goroutine, and add it to a set of running
-	// functions.
-	for _, fn := range functions {
+	// start calls a function in its own goroutine, and adds it to the set of
+	// running functions.
+	start := func(fn funcConfig, ready chan<- *function) *function {
+		var deliverySlots chan struct{}
+		if cfg.Concurrency > 0 {
+			deliverySlots = make(chan struct{}, cfg.Concurrency)
+		}
+
 		f := &function{
-			Func:          fn,
-			Inbox:         make(chan any),
-			Outbox:        make(chan any),
+			Index:         len(results),
+			Name:          fn.Name,
+			Config:        &cfg,
+			DeliverySlots: deliverySlots,
+			Workers:       workers,
+			Deadlock:      deadlock,
+			SessionDone:   ctx.Done(),
+			Live:          &live,
+			Func:          fn.Func,
+			SelfDelivery:  fn.SelfDelivery,
+			Group:         fn.Group,
+			Interceptor:   fn.Interceptor,
+			Inbox:         make(chan envelope, cfg.InboxBuffer),
+			Outbox:        make(chan any, cfg.OutboxBuffer),
+			Background:    &calls,
 			Subscriptions: subs,
-			ReadySignal:   readySignal,
+			ReadySignal:   ready,
+			ReadyLatch:    readyLatch,
 			ReturnSignal:  returnSignal,
+			SpawnSignal:   spawnSignal,
+			FailSignal:    failSignal,
 			ReturnLatch:   make(chan struct{}),
+			StopLatch:     make(chan struct{}),
+			OutboxLatch:   make(chan struct{}),
+			PumpLatch:     make(chan struct{}),
+		}
+
+		for _, t := range fn.Publications {
+			if f.publications == nil {
+				f.publications = map[reflect.Type]struct{}{}
+			}
+			f.publications[t] = struct{}{}
+		}
+
+		for _, t := range cfg.Subscriptions[f.Name] {
+			f.Subscribe(ctx, t, nil)
+		}
+
+		if inspector != nil {
+			inspector.add(f)
 		}
 
 		running[f] = struct{}{}
+		results = append(results, nil)
+		live.Add(1)
+
+		calls.Add(1)
+		go func() {
+			defer calls.Done()
+			f.Call(ctx)
+		}()
+
+		return f
+	}
+
+	// startLatePump starts the message pump of a function that is not
+	// included in the barrier as soon as the function itself is ready.
+	startLatePump := func(f *function, ready <-chan *function) {
+		pumps.Add(1)
+		go func() {
+			defer pumps.Done()
+
+			select {
+			case <-ctx.Done():
+			case <-f.ReturnLatch:
+			case <-ready:
+			}
+
+			// Replay any retained messages that the function missed,
+			// alongside the pump, so that neither waits for the other.
+			// Only a function that is not included in the barrier can miss
+			// a retained message, as all other functions subscribe before
+			// the barrier.
+			pumps.Add(1)
+			go func() {
+				defer pumps.Done()
+				f.Replay(deliveryCtx)
+			}()
+
+			f.Pump(ctx, deliveryCtx)
+		}()
+	}
+
+	// late is the set of functions that are not included in the barrier, as
+	// per [WithLateJoin], mapped to the channel on which each signals its own
+	// readiness.
+	late := map[*function]chan *function{}
+
+	// startBatch starts the next batch of functions, as per
+	// [WithStagedStart].
+	started := make([]*function, 0, len(functions))
+	startBatch := func() {
+		n := min(len(started)+batch, len(functions))
 
-		go f.Call(ctx)
+		for _, fn := range functions[len(started):n] {
+			if fn.LateJoin {
+				ready := make(chan *function, 1)
+				f := start(fn, ready)
+				late[f] = ready
+				started = append(started, f)
+			} else {
+				started = append(started, start(fn, readySignal))
+			}
+		}
+	}
+
+	// required returns the number of running functions that are included in
+	// the barrier.
+	required := func() int {
+		n := len(running)
+		for f := range late {
+			if _, ok := running[f]; ok {
+				n--
+			}
+		}
+		return n
 	}
 
-	// Wait for all functions to signal readiness.
-	readyCount := 0
-	for readyCount < len(running) {
+	// Wait for all functions to signal readiness, starting each batch once
+	// the functions that have already been started are ready. Functions that
+	// return are no longer waited for, whether or not they were ready.
+	ready := map[*function]struct{}{}
+
+	var slowReady <-chan time.Time
+	if cfg.SlowReadyThreshold > 0 {
+		t := time.NewTimer(cfg.SlowReadyThreshold)
+		defer t.Stop()
+		slowReady = t.C
+	}
+
+	for {
+		if len(ready) >= required() {
+			if len(started) == len(functions) {
+				break
+			}
+			startBatch()
+			continue
+		}
+
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 
-		case <-readySignal:
-			readyCount++
+		case <-slowReady:
+			for _, f := range started {
+				if _, ok := running[f]; !ok {
+					continue
+				}
+				if _, ok := late[f]; ok {
+					continue
+				}
+				if _, ok := ready[f]; !ok {
+					f.warn(
+						ctx,
+						"not ready",
+						slog.Duration("elapsed", cfg.SlowReadyThreshold),
+					)
+				}
+			}
+
+		case f := <-readySignal:
+			// The signal may be processed after the function has already
+			// returned.
+			if _, ok := running[f]; ok {
+				ready[f] = struct{}{}
+			}
 
 		case r := <-returnSignal:
 			delete(running, r.Func)
+			delete(ready, r.Func)
+			results[r.Func.Index] = r.Err
 			if r.Err != nil {
 				return r.Err
 			}
 		}
 	}
 
+	// Check the topology of the functions that are still running, now that
+	// they have all subscribed to, and declared, the types that they use.
+	var participants []*function
+	for _, f := range started {
+		if _, ok := running[f]; ok {
+			participants = append(participants, f)
+		}
+	}
+	topo := topologyOf(subs, participants)
+	warnTopology(ctx, &cfg, topo)
+
+	if cfg.RequireSubscribers {
+		if err := topo.RequireSubscribers(); err != nil {
+			failure = err
+			return err
+		}
+	}
+
+	// Signal any functions that are waiting for the barrier in WaitReady().
+	close(readyLatch)
+
+	if cfg.Ready != nil {
+		cfg.Ready()
+	}
+
 	// Start each functions message pump, unblocking the outbox channels, and
-	// delivering to the inboxes.
-	for f := range running {
+	// delivering to the inboxes. Functions that have already returned still
+	// need a pump to deliver any messages that are buffered in their outbox.
+	for _, f := range started {
+		if ready, ok := late[f]; ok {
+			startLatePump(f, ready)
+			continue
+		}
+
 		pumps.Add(1)
 		go func() {
 			defer pumps.Done()
-			f.Pump(ctx)
+			f.Pump(ctx, deliveryCtx)
 		}()
 	}
 
@@ -97,13 +395,65 @@ func Run(
 		case <-ctx.Done():
 			return ctx.Err()
 
+		case err := <-failSignal:
+			failure = err
+			return err
+
+		case <-deadlockSignal:
+			if deadlock.IsDeadlocked(len(running)) {
+				failure = ErrDeadlock
+				return ErrDeadlock
+			}
+
+		case fn := <-spawnSignal:
+			// The spawned function has missed the barrier, so its message
+			// pump starts as soon as the function itself is ready.
+			ready := make(chan *function, 1)
+			startLatePump(start(fn, ready), ready)
+
 		case r := <-returnSignal:
 			delete(running, r.Func)
+			results[r.Func.Index] = r.Err
 			if r.Err != nil {
 				return r.Err
 			}
+
+			// The remaining functions may have been waiting for messages from
+			// the function that returned.
+			if deadlock.IsDeadlocked(len(running)) {
+				failure = ErrDeadlock
+				return ErrDeadlock
+			}
 		}
 	}
 
 	return ctx.Err()
 }
+
+// aggregateErrors returns the error to return from a call to [Run] that uses
+// the [WithErrorAggregation] option.
+//
+// The errors are joined in the order that the functions were added. The error
+// from the parent context, if any, is placed first, followed by the error that
+// caused the session to fail outside of any function, such as in middleware.
+// Errors that only indicate that the session's context was canceled are
+// omitted, as they are a symptom of shutting down, not a failure.
+func aggregateErrors(parent, session context.Context, failure error, results []error) error {
+	var errs []error
+
+	if err := parent.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if failure != nil {
+		errs = append(errs, failure)
+	}
+
+	for _, err := range results {
+		if err != nil && !errors.Is(err, session.Err()) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
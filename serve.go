@@ -0,0 +1,34 @@
+package minibus
+
+import "context"
+
+// Serve returns a [Func] that subscribes to messages of type M and calls
+// handler for each message it receives.
+//
+// Messages are handled sequentially, in the order they are received. The
+// function returns when handler returns a non-nil error, which it returns, or
+// when ctx is canceled.
+func Serve[M any](handler func(context.Context, M) error) Func {
+	h := func(ctx context.Context, m any) error {
+		v, _ := m.(M)
+		return handler(ctx, v)
+	}
+
+	return func(ctx context.Context) error {
+		Subscribe[M](ctx)
+		Ready(ctx)
+
+		f := caller(ctx)
+
+		for {
+			m, err := Receive(ctx)
+			if err != nil {
+				return err
+			}
+
+			if err := f.Handle(ctx, m, h); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package minibus_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestServe(t *testing.T) {
+	t.Run("it calls the handler for each message of the subscribed type", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received []string
+		done := errors.New("<done>")
+
+		err := Run(
+			ctx,
+			WithFunc(
+				Serve(
+					func(_ context.Context, m string) error {
+						received = append(received, m)
+						if len(received) == 2 {
+							return done
+						}
+						return nil
+					},
+				),
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					if err := Send(ctx, "<one>"); err != nil {
+						return err
+					}
+
+					if err := Send(ctx, 42); err != nil {
+						return err
+					}
+
+					return Send(ctx, "<two>")
+				},
+			),
+		)
+
+		if err != done {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, done)
+		}
+
+		if want := []string{"<one>", "<two>"}; !slices.Equal(received, want) {
+			t.Fatalf("unexpected messages: got %v, want %v", received, want)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package minibus
+
+import (
+	"context"
+	"slices"
+)
+
+// Session is a reusable set of functions and options that can be executed by
+// [Run] any number of times.
+type Session struct {
+	options []Option
+}
+
+// NewSession returns a new session that executes functions according to the
+// given options.
+func NewSession(options ...Option) *Session {
+	return &Session{
+		options: slices.Clone(options),
+	}
+}
+
+// Run executes the session's functions by calling [Run] with the session's
+// options.
+//
+// Each call to Run is independent of any other; the functions' inboxes,
+// outboxes and subscriptions are created anew each time. It's safe to call Run
+// concurrently, provided the functions themselves are safe to execute
+// concurrently.
+//
+// Options that refer to values outside the session are shared by every call.
+// For example, the [Report] passed to [WithReport] is reset by each call, so
+// it's only meaningful if the calls are not concurrent, and the function
+// passed to [WithInspector] is called with a new [Inspector] for each call.
+func (s *Session) Run(ctx context.Context) error {
+	return Run(ctx, s.options...)
+}
+
+// RunAsync executes the session's functions in the background by calling
+// [RunAsync] with the session's options.
+func (s *Session) RunAsync(ctx context.Context) *Execution {
+	return RunAsync(ctx, s.options...)
+}
@@ -0,0 +1,74 @@
+package minibus_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+func TestSession(t *testing.T) {
+	t.Run("it can be run more than once", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received []string
+
+		session := NewSession(
+			WithFunc(Once("<message>")),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					m, err := ReceiveAs[string](ctx)
+					if err != nil {
+						return err
+					}
+					received = append(received, m)
+
+					// Verify that no messages remain from the previous run.
+					if _, err := ReceiveTimeout(ctx, 10*time.Millisecond); err != context.DeadlineExceeded {
+						t.Errorf("unexpected result from ReceiveTimeout(): got %v, want %q", err, context.DeadlineExceeded)
+					}
+
+					return nil
+				},
+			),
+		)
+
+		for range 2 {
+			if err := session.Run(ctx); err != nil {
+				t.Fatalf("Run() returned an unexpected error: %s", err)
+			}
+		}
+
+		if len(received) != 2 {
+			t.Fatalf("unexpected number of messages: got %d, want 2", len(received))
+		}
+	})
+	t.Run("it can be run in the background", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var received []string
+
+		session := NewSession(
+			WithFunc(Once("<message>")),
+			WithFunc(Collect(&received)),
+		)
+
+		e := session.RunAsync(ctx)
+
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		if err := e.Wait(); err != context.Canceled {
+			t.Fatalf("unexpected error: got %v, want %q", err, context.Canceled)
+		}
+
+		if len(received) != 1 {
+			t.Fatalf("unexpected number of messages: got %d, want 1", len(received))
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package minibus
+
+import (
+	"reflect"
+	"time"
+)
+
+// Stats is an interface for collecting statistics about the functions executed
+// by [Run] and the messages they exchange.
+//
+// It allows metrics libraries, such as Prometheus, to be integrated without
+// this package depending on them. The methods may be called concurrently, so
+// implementations must be safe for concurrent use, and they should not block.
+//
+// Each method is passed the name of the function that the statistic relates
+// to, allowing the statistics to be broken down by function.
+//
+// See [WithStats].
+type Stats interface {
+	// FuncStarted is called when the function named fn is started.
+	FuncStarted(fn string)
+
+	// FuncReturned is called when the function named fn returns, with the
+	// error it returned, if any.
+	FuncReturned(fn string, err error)
+
+	// MessageSent is called when the function named fn sends a message of type
+	// t, before it's routed to its recipients. t is the type used for routing,
+	// which is usually the message's dynamic type.
+	MessageSent(fn string, t reflect.Type)
+
+	// MessageDelivered is called each time a message of type t is placed in the
+	// inbox of the function named fn. latency is the time elapsed since the
+	// message was sent, which includes any time spent waiting in the sender's
+	// outbox and for space in the recipient's inbox.
+	MessageDelivered(fn string, t reflect.Type, latency time.Duration)
+
+	// MessageReceived is called each time the function named fn receives a
+	// message of type t from its inbox.
+	MessageReceived(fn string, t reflect.Type)
+
+	// MessageHandled is called when the function named fn has finished
+	// handling a message of type t, where d is the time spent handling it.
+	//
+	// It's only called for messages that are handled by [ReceiveFunc],
+	// [Serve], [Router] or the other handler-based helpers, as the time spent
+	// handling a message received by [Receive] is not known.
+	MessageHandled(fn string, t reflect.Type, d time.Duration)
+
+	// MessageDropped is called when a message of type t has no recipients, is
+	// dropped by inbound middleware or under the [DropWhenFull] policy, or is
+	// not delivered to a recipient because the recipient returned or the
+	// session shut down first. fn is the name of the recipient, or of the
+	// sender if the message has no recipients or is dropped by middleware or
+	// under the [DropWhenFull] policy.
+	MessageDropped(fn string, t reflect.Type)
+}
+
+// noopStats is the [Stats] implementation used when [WithStats] is not used.
+type noopStats struct{}
+
+func (noopStats) FuncStarted(string)                                   {}
+func (noopStats) FuncReturned(string, error)                           {}
+func (noopStats) MessageSent(string, reflect.Type)                     {}
+func (noopStats) MessageDelivered(string, reflect.Type, time.Duration) {}
+func (noopStats) MessageReceived(string, reflect.Type)                 {}
+func (noopStats) MessageHandled(string, reflect.Type, time.Duration)   {}
+func (noopStats) MessageDropped(string, reflect.Type)                  {}
+
+// isCollected returns true if statistics are being collected, as per
+// [WithStats].
+func (f *function) isCollected() bool {
+	_, ok := f.Config.Stats.(noopStats)
+	return !ok
+}
+
+// stamp returns the envelope for m, stamped with the current time as the time
+// it was sent, if it's not already stamped.
+func stamp(m any) envelope {
+	env := envelopeOf(m)
+	if env.SentAt.IsZero() {
+		env.SentAt = time.Now()
+	}
+	return env
+}
+
+// delivered records that env has been placed in f's inbox.
+func (f *function) delivered(env envelope) {
+	var latency time.Duration
+	if !env.SentAt.IsZero() {
+		latency = time.Since(env.SentAt)
+	}
+
+	f.Config.Stats.MessageDelivered(f.Name, env.Type, latency)
+	f.emit(MessageDelivered{env.Type, f.Name})
+
+	// The function may have returned or stopped after the message was placed
+	// in its inbox, in which case it will never be received.
+	if f.isFinished() {
+		f.discardInbox()
+	}
+}
@@ -0,0 +1,263 @@
+package minibus_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+// recordingStats is a [Stats] implementation that records the number of calls
+// to each method.
+type recordingStats struct {
+	m         sync.Mutex
+	Started   []string
+	Returned  []error
+	Sent      map[reflect.Type]int
+	Delivered map[reflect.Type]int
+	Dropped   map[reflect.Type]int
+	SentBy    map[string]int
+	Received  map[string]int
+	Handled   map[string]int
+	Latency   []time.Duration
+}
+
+func (s *recordingStats) FuncStarted(fn string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.Started = append(s.Started, fn)
+}
+
+func (s *recordingStats) FuncReturned(_ string, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.Returned = append(s.Returned, err)
+}
+
+func (s *recordingStats) MessageSent(fn string, t reflect.Type) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.Sent = increment(s.Sent, t)
+	s.SentBy = increment(s.SentBy, fn)
+}
+
+func (s *recordingStats) MessageDelivered(_ string, t reflect.Type, latency time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.Delivered = increment(s.Delivered, t)
+	s.Latency = append(s.Latency, latency)
+}
+
+func (s *recordingStats) MessageReceived(fn string, _ reflect.Type) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.Received = increment(s.Received, fn)
+}
+
+func (s *recordingStats) MessageHandled(fn string, _ reflect.Type, _ time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.Handled = increment(s.Handled, fn)
+}
+
+func (s *recordingStats) MessageDropped(_ string, t reflect.Type) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.Dropped = increment(s.Dropped, t)
+}
+
+func increment[K comparable](counts map[K]int, k K) map[K]int {
+	if counts == nil {
+		counts = map[K]int{}
+	}
+	counts[k]++
+	return counts
+}
+
+func TestWithStats(t *testing.T) {
+	t.Run("it reports statistics about functions and messages", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		stats := &recordingStats{}
+		funcErr := errors.New("<error>")
+
+		err := Run(
+			ctx,
+			WithStats(stats),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					for range 2 {
+						if _, err := Receive(ctx); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range 2 {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					if err := SendSync(ctx, "<unsubscribed>"); err != nil {
+						return err
+					}
+
+					return funcErr
+				},
+			),
+		)
+
+		if err != funcErr {
+			t.Fatalf("Run() returned an unexpected error: got %q, want %q", err, funcErr)
+		}
+
+		intType := reflect.TypeFor[int]()
+		stringType := reflect.TypeFor[string]()
+
+		if len(stats.Started) != 2 {
+			t.Fatalf("unexpected number of started functions: got %d, want 2", len(stats.Started))
+		}
+
+		if len(stats.Returned) != 2 {
+			t.Fatalf("unexpected number of returned functions: got %d, want 2", len(stats.Returned))
+		}
+
+		if n := stats.Sent[intType]; n != 2 {
+			t.Fatalf("unexpected number of sent int messages: got %d, want 2", n)
+		}
+
+		if n := stats.Sent[stringType]; n != 1 {
+			t.Fatalf("unexpected number of sent string messages: got %d, want 1", n)
+		}
+
+		if n := stats.Delivered[intType]; n != 2 {
+			t.Fatalf("unexpected number of delivered int messages: got %d, want 2", n)
+		}
+
+		if n := stats.Dropped[stringType]; n != 1 {
+			t.Fatalf("unexpected number of dropped string messages: got %d, want 1", n)
+		}
+	})
+	t.Run("it reports statistics for each function by name", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		stats := &recordingStats{}
+		errDone := errors.New("<done>")
+
+		err := Run(
+			ctx,
+			WithStats(stats),
+			WithNamedFunc(
+				"<consumer>",
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					n := 0
+					return ReceiveFunc(
+						ctx,
+						func(context.Context, any) error {
+							if n++; n == 3 {
+								return errDone
+							}
+							return nil
+						},
+					)
+				},
+			),
+			WithNamedFunc(
+				"<producer>",
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					for i := range 3 {
+						if err := Send(ctx, i); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			),
+		)
+		if err != errDone {
+			t.Fatalf("Run() returned an unexpected error: got %v, want %q", err, errDone)
+		}
+
+		slices.Sort(stats.Started)
+
+		want := []string{"<consumer>", "<producer>"}
+		if !slices.Equal(stats.Started, want) {
+			t.Fatalf("unexpected started functions: got %v, want %v", stats.Started, want)
+		}
+
+		if n := stats.SentBy["<producer>"]; n != 3 {
+			t.Fatalf("unexpected number of messages sent by <producer>: got %d, want 3", n)
+		}
+
+		if n := stats.Received["<consumer>"]; n != 3 {
+			t.Fatalf("unexpected number of messages received by <consumer>: got %d, want 3", n)
+		}
+
+		if n := stats.Handled["<consumer>"]; n != 3 {
+			t.Fatalf("unexpected number of messages handled by <consumer>: got %d, want 3", n)
+		}
+	})
+	t.Run("it reports the latency of each delivery", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		stats := &recordingStats{}
+		const delay = 20 * time.Millisecond
+
+		err := Run(
+			ctx,
+			WithStats(stats),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[int](ctx)
+					Ready(ctx)
+
+					time.Sleep(delay)
+
+					_, err := Receive(ctx)
+					return err
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, 1)
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if len(stats.Latency) != 1 {
+			t.Fatalf("unexpected number of deliveries: got %d, want 1", len(stats.Latency))
+		}
+
+		if l := stats.Latency[0]; l < delay {
+			t.Fatalf("unexpected latency: got %s, want at least %s", l, delay)
+		}
+	})
+}
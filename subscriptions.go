@@ -1,20 +1,43 @@
 package minibus
 
 import (
+	"maps"
 	"reflect"
 	"sync"
 )
 
+// filter is a predicate that determines whether a message is delivered to a
+// subscriber. A nil filter accepts all messages.
+type filter func(m any) bool
+
 type subscriptions struct {
-	m         sync.Mutex
-	functions map[*function]map[reflect.Type]struct{}
-	types     map[reflect.Type]*subscriptionsForType
+	m sync.Mutex
+
+	// functions is the set of types that each function subscribes to directly,
+	// that is, the types passed to [Subscribe], along with the filter that
+	// applies to each subscription.
+	functions map[*function]map[reflect.Type]filter
+
+	types map[reflect.Type]*subscriptionsForType
+
+	// retained is the most recent message of each type that was sent using
+	// [SendRetained].
+	retained map[reflect.Type]envelope
+
+	// replays is the set of retained messages that each function has yet to
+	// receive because it subscribed after they were sent.
+	replays map[*function][]envelope
 }
 
 // subscriptionsForType is a collection of the functions that subscribe to a
 // particular message type.
 type subscriptionsForType struct {
-	Members map[*function]struct{}
+	// Members is the set of functions that receive this message type, mapped
+	// to the filter that applies to each of them.
+	//
+	// Once IsFinalized is true the map may be in use by a message pump, so it
+	// must not be modified. Instead, it is replaced with an updated copy.
+	Members map[*function]filter
 
 	// IsFinalized is set to true once the subscribers set has been updated to
 	// include functions that receive this message type because they subscribe
@@ -23,51 +46,242 @@ type subscriptionsForType struct {
 	IsFinalized bool
 }
 
-func (s *subscriptions) Add(fn *function, t reflect.Type) {
+// Add subscribes fn to messages of type t. If fn already subscribes to t, the
+// subscription's filter is replaced with flt.
+func (s *subscriptions) Add(fn *function, t reflect.Type, flt filter) {
 	s.m.Lock()
 	defer s.m.Unlock()
 
 	if s.functions == nil {
-		s.functions = map[*function]map[reflect.Type]struct{}{}
+		s.functions = map[*function]map[reflect.Type]filter{}
 	}
 
-	subs := s.forType(t)
-	subs.Members[fn] = struct{}{}
-
 	types, ok := s.functions[fn]
 	if !ok {
-		types = map[reflect.Type]struct{}{}
+		types = map[reflect.Type]filter{}
 		s.functions[fn] = types
 	}
 
-	types[t] = struct{}{}
+	// Find the retained messages that fn does not already receive, so that
+	// those it receives because of this subscription can be replayed.
+	var missed []reflect.Type
+	for rt := range s.retained {
+		if _, ok := s.filterFor(fn, rt); !ok {
+			missed = append(missed, rt)
+		}
+	}
+
+	types[t] = flt
+
+	s.update(fn, t)
+
+	for _, rt := range missed {
+		if _, ok := s.filterFor(fn, rt); ok {
+			if s.replays == nil {
+				s.replays = map[*function][]envelope{}
+			}
+
+			// The replay is pending from now until it's delivered or dropped.
+			fn.Deadlock.Add(1)
+			s.retained[rt].Depth.Add(1)
+			s.replays[fn] = append(s.replays[fn], s.retained[rt])
+		}
+	}
+
+	// If t is an interface, any message types that have already been finalized
+	// and implement t must include fn. The remaining types will include it
+	// when they are finalized.
+	if t.Kind() == reflect.Interface {
+		for messageType, subs := range s.types {
+			if subs.IsFinalized && messageType != t && messageType.Implements(t) {
+				s.update(fn, messageType)
+			}
+		}
+	}
+}
+
+// Count returns the number of types that fn subscribes to directly.
+func (s *subscriptions) Count(fn *function) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return len(s.functions[fn])
+}
+
+// RemoveType removes fn's subscription to t, including any subscriptions to
+// other types that were derived from it.
+func (s *subscriptions) RemoveType(fn *function, t reflect.Type) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	types := s.functions[fn]
+	if _, ok := types[t]; !ok {
+		return
+	}
+
+	delete(types, t)
+
+	for messageType, subs := range s.types {
+		if _, ok := subs.Members[fn]; ok {
+			s.update(fn, messageType)
+		}
+	}
 }
 
+// Remove removes all of fn's subscriptions.
 func (s *subscriptions) Remove(fn *function) {
 	s.m.Lock()
 	defer s.m.Unlock()
 
+	delete(s.functions, fn)
+
+	for _, subs := range s.types {
+		if _, ok := subs.Members[fn]; ok {
+			subs.remove(fn)
+		}
+	}
+}
+
+// Direct returns the types that fn subscribes to directly, sorted by name.
+func (s *subscriptions) Direct(fn *function) []reflect.Type {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	types := make([]reflect.Type, 0, len(s.functions[fn]))
 	for t := range s.functions[fn] {
-		subs := s.forType(t)
-		delete(subs.Members, fn)
+		types = append(types, t)
 	}
 
-	delete(s.functions, fn)
+	sortTypes(types)
+
+	return types
+}
+
+// Types returns the types of the messages that fn receives, sorted by name.
+//
+// It includes the types that fn subscribes to directly, and the types that
+// have been routed so far that implement an interface that fn subscribes to.
+func (s *subscriptions) Types(fn *function) []reflect.Type {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var types []reflect.Type
+
+	for t := range s.knownTypes() {
+		if _, ok := s.filterFor(fn, t); ok {
+			types = append(types, t)
+		}
+	}
+
+	sortTypes(types)
+
+	return types
+}
+
+// Counts returns the number of functions that receive each message type.
+//
+// It includes the types that any function subscribes to directly, and the
+// types that have been routed so far. Types with no subscribers are omitted.
+func (s *subscriptions) Counts() map[reflect.Type]int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	counts := map[reflect.Type]int{}
+
+	for t := range s.knownTypes() {
+		for fn := range s.functions {
+			if _, ok := s.filterFor(fn, t); ok {
+				counts[t]++
+			}
+		}
+	}
+
+	return counts
+}
+
+// knownTypes returns the set of types that any function subscribes to
+// directly, along with the types that have been routed so far.
+func (s *subscriptions) knownTypes() map[reflect.Type]struct{} {
+	types := map[reflect.Type]struct{}{}
+
+	for t := range s.types {
+		types[t] = struct{}{}
+	}
+
+	for _, subscribed := range s.functions {
+		for t := range subscribed {
+			types[t] = struct{}{}
+		}
+	}
+
+	return types
 }
 
-func (s *subscriptions) Subscribers(t reflect.Type) map[*function]struct{} {
+// Subscribers returns the functions that receive messages routed as type t,
+// mapped to the filter that applies to each of them.
+func (s *subscriptions) Subscribers(t reflect.Type) map[*function]filter {
 	s.m.Lock()
 	defer s.m.Unlock()
 
+	return s.subscribers(t)
+}
+
+// Retain stores env as the retained message for its type, replacing any
+// existing retained message of that type, and returns its subscribers.
+//
+// Storing the message and finding its subscribers is atomic with respect to
+// [subscriptions.Add], so each function either receives the message from its
+// sender, or has it replayed.
+func (s *subscriptions) Retain(env envelope) map[*function]filter {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.retained == nil {
+		s.retained = map[reflect.Type]envelope{}
+	}
+
+	// The sender is not waiting for replays to be delivered.
+	env.Done = nil
+	env.Ack = nil
+
+	s.retained[env.Type] = env
+
+	return s.subscribers(env.Type)
+}
+
+// Replays returns the retained messages that fn has yet to receive, and that
+// it still receives given its current subscriptions. It removes them, so each
+// message is only returned once.
+//
+// Each message that is not returned is dropped.
+func (s *subscriptions) Replays(fn *function) []envelope {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var envs []envelope
+
+	for _, env := range s.replays[fn] {
+		if flt, ok := s.filterFor(fn, env.Type); ok && env.isRecipient(fn, flt) {
+			envs = append(envs, env)
+		} else {
+			fn.drop(env)
+		}
+	}
+
+	delete(s.replays, fn)
+
+	return envs
+}
+
+// subscribers returns the functions that receive messages routed as type t.
+// s.m must be held.
+func (s *subscriptions) subscribers(t reflect.Type) map[*function]filter {
 	subs := s.forType(t)
 
 	if !subs.IsFinalized {
-		for subscribedType, subscribers := range s.types {
-			if subscribedType.Kind() == reflect.Interface && t.Implements(subscribedType) {
-				for f := range subscribers.Members {
-					subs.Members[f] = struct{}{}
-					s.functions[f][t] = struct{}{}
-				}
+		for fn := range s.functions {
+			if flt, ok := s.filterFor(fn, t); ok {
+				subs.Members[fn] = flt
 			}
 		}
 		subs.IsFinalized = true
@@ -76,12 +290,63 @@ func (s *subscriptions) Subscribers(t reflect.Type) map[*function]struct{} {
 	return subs.Members
 }
 
+// update recomputes fn's membership of the subscribers for type t.
+func (s *subscriptions) update(fn *function, t reflect.Type) {
+	subs := s.forType(t)
+
+	if flt, ok := s.filterFor(fn, t); ok {
+		subs.set(fn, flt)
+	} else {
+		subs.remove(fn)
+	}
+}
+
+// filterFor returns the filter that applies to messages routed as type t when
+// they are delivered to fn. ok is false if fn's direct subscriptions do not
+// cause it to receive such messages at all.
+//
+// If fn receives t by way of several subscriptions, a message is accepted if
+// any of their filters accept it.
+func (s *subscriptions) filterFor(fn *function, t reflect.Type) (_ filter, ok bool) {
+	var filters []filter
+
+	for subscribedType, flt := range s.functions[fn] {
+		if subscribedType != t {
+			if subscribedType.Kind() != reflect.Interface || !t.Implements(subscribedType) {
+				continue
+			}
+		}
+
+		if flt == nil {
+			return nil, true
+		}
+
+		filters = append(filters, flt)
+	}
+
+	switch len(filters) {
+	case 0:
+		return nil, false
+	case 1:
+		return filters[0], true
+	default:
+		return func(m any) bool {
+			for _, flt := range filters {
+				if flt(m) {
+					return true
+				}
+			}
+			return false
+		}, true
+	}
+}
+
 func (s *subscriptions) forType(t reflect.Type) *subscriptionsForType {
 	subs, ok := s.types[t]
 
 	if !ok {
 		subs = &subscriptionsForType{
-			Members: map[*function]struct{}{},
+			Members: map[*function]filter{},
 		}
 
 		if s.types == nil {
@@ -93,3 +358,25 @@ func (s *subscriptions) forType(t reflect.Type) *subscriptionsForType {
 
 	return subs
 }
+
+// set adds fn to the members of s, with the given filter.
+func (s *subscriptionsForType) set(fn *function, flt filter) {
+	if s.IsFinalized {
+		s.Members = maps.Clone(s.Members)
+	}
+
+	s.Members[fn] = flt
+}
+
+// remove removes fn from the members of s.
+func (s *subscriptionsForType) remove(fn *function) {
+	if _, ok := s.Members[fn]; !ok {
+		return
+	}
+
+	if s.IsFinalized {
+		s.Members = maps.Clone(s.Members)
+	}
+
+	delete(s.Members, fn)
+}
@@ -0,0 +1,336 @@
+package minibus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSubscribers is wrapped by the error returned by [Run] when the
+// [WithRequireSubscribers] option is used and a function declares that it
+// sends a message type that no other function subscribes to.
+var ErrNoSubscribers = errors.New("minibus: published message type has no subscribers")
+
+// Topology describes the message types that each function in a session sends
+// and receives.
+//
+// See [Inspector.Topology].
+type Topology struct {
+	// Functions describes each function, in the order that they were started.
+	Functions []FuncTopology
+}
+
+// FuncTopology describes the message types that a single function sends and
+// receives.
+type FuncTopology struct {
+	// Name is the function's name, as per [Name].
+	Name string
+
+	// Publications are the types that the function has declared that it
+	// sends, using [Publish] or [WithOutputTypes], sorted by name.
+	Publications []reflect.Type
+
+	// Subscriptions are the types that the function subscribes to directly,
+	// sorted by name.
+	Subscriptions []reflect.Type
+
+	// SelfDelivery is true if the function receives the messages that it
+	// sends, as per [WithSelfDelivery].
+	SelfDelivery bool
+}
+
+// topologyEdge is a message type that may be sent from one function to
+// another, identified by their indices within [Topology.Functions].
+type topologyEdge struct {
+	From, To int
+	Type     reflect.Type
+}
+
+// edges returns the message types that may be sent between the functions.
+// Messages are only known to be sent if their types have been declared.
+func (t Topology) edges() []topologyEdge {
+	var edges []topologyEdge
+
+	for i, pub := range t.Functions {
+		for _, p := range pub.Publications {
+			for j, sub := range t.Functions {
+				if i == j && !sub.SelfDelivery {
+					continue
+				}
+
+				if slices.ContainsFunc(
+					sub.Subscriptions,
+					func(s reflect.Type) bool {
+						return mayRoute(p, s)
+					},
+				) {
+					edges = append(edges, topologyEdge{i, j, p})
+				}
+			}
+		}
+	}
+
+	return edges
+}
+
+// DOT returns a Graphviz DOT representation of the topology, with a node for
+// each function and an edge labeled with each message type that may be sent
+// from one function to another.
+//
+// Only the message types that have been declared using [Publish] or
+// [WithOutputTypes] are represented as edges.
+func (t Topology) DOT() string {
+	var w strings.Builder
+
+	w.WriteString("digraph {\n")
+
+	for i, f := range t.Functions {
+		fmt.Fprintf(&w, "\tf%d [label=%s];\n", i, strconv.Quote(f.Name))
+	}
+
+	for _, e := range t.edges() {
+		fmt.Fprintf(&w, "\tf%d -> f%d [label=%s];\n", e.From, e.To, strconv.Quote(e.Type.String()))
+	}
+
+	w.WriteString("}\n")
+
+	return w.String()
+}
+
+// Mermaid returns a Mermaid flowchart representation of the topology, with a
+// node for each function and an edge labeled with each message type that may
+// be sent from one function to another.
+//
+// Only the message types that have been declared using [Publish] or
+// [WithOutputTypes] are represented as edges.
+func (t Topology) Mermaid() string {
+	var w strings.Builder
+
+	w.WriteString("flowchart LR\n")
+
+	for i, f := range t.Functions {
+		fmt.Fprintf(&w, "\tf%d[\"%s\"]\n", i, mermaidEscape(f.Name))
+	}
+
+	for _, e := range t.edges() {
+		fmt.Fprintf(&w, "\tf%d -->|\"%s\"| f%d\n", e.From, mermaidEscape(e.Type.String()), e.To)
+	}
+
+	return w.String()
+}
+
+// mermaidEscape escapes s for use within a quoted Mermaid label.
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
+
+// Publications returns the types that the function has declared that it sends.
+func (f *function) Publications() []reflect.Type {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	types := make([]reflect.Type, 0, len(f.publications))
+	for t := range f.publications {
+		types = append(types, t)
+	}
+
+	return types
+}
+
+// mayRoute returns true if a message of a type declared as p may be delivered
+// to a function that subscribes to s.
+//
+// If p is an interface, the declaration covers messages of any type that
+// implements it, so p may be routed to a subscription to such a type.
+func mayRoute(p, s reflect.Type) bool {
+	if p == s {
+		return true
+	}
+
+	if s.Kind() == reflect.Interface && p.Implements(s) {
+		return true
+	}
+
+	return p.Kind() == reflect.Interface && s.Implements(p)
+}
+
+// topology is a snapshot of the types that a set of functions declare that
+// they send, and the types that they subscribe to.
+type topology struct {
+	Functions     []*function
+	Publications  map[*function][]reflect.Type
+	Subscriptions map[*function][]reflect.Type
+}
+
+// topologyOf returns a snapshot of the topology of the given functions.
+func topologyOf(subs *subscriptions, functions []*function) topology {
+	t := topology{
+		Functions:     functions,
+		Publications:  map[*function][]reflect.Type{},
+		Subscriptions: map[*function][]reflect.Type{},
+	}
+
+	for _, f := range functions {
+		t.Publications[f] = f.Publications()
+	}
+
+	subs.m.Lock()
+	defer subs.m.Unlock()
+
+	for _, f := range functions {
+		for st := range subs.functions[f] {
+			t.Subscriptions[f] = append(t.Subscriptions[f], st)
+		}
+	}
+
+	for _, types := range t.Publications {
+		sortTypes(types)
+	}
+
+	for _, types := range t.Subscriptions {
+		sortTypes(types)
+	}
+
+	return t
+}
+
+// Export returns the exported representation of the topology.
+func (t topology) Export() Topology {
+	var x Topology
+
+	for _, f := range t.Functions {
+		x.Functions = append(
+			x.Functions,
+			FuncTopology{
+				Name:          f.Name,
+				Publications:  t.Publications[f],
+				Subscriptions: t.Subscriptions[f],
+				SelfDelivery:  f.SelfDelivery,
+			},
+		)
+	}
+
+	return x
+}
+
+// sortTypes sorts types by name.
+func sortTypes(types []reflect.Type) {
+	slices.SortFunc(
+		types,
+		func(a, b reflect.Type) int {
+			return strings.Compare(a.String(), b.String())
+		},
+	)
+}
+
+// Unsubscribed returns the types that each function declares that it sends,
+// but that no function that may receive its messages subscribes to.
+func (t topology) Unsubscribed() map[*function][]reflect.Type {
+	return t.unmatched(t.Publications, t.Subscriptions, mayRoute)
+}
+
+// Unpublished returns the types that each function subscribes to, but that no
+// function that may send messages to it declares that it sends.
+func (t topology) Unpublished() map[*function][]reflect.Type {
+	return t.unmatched(
+		t.Subscriptions,
+		t.Publications,
+		func(s, p reflect.Type) bool {
+			return mayRoute(p, s)
+		},
+	)
+}
+
+// unmatched returns the types in each function's entry in types that do not
+// match any of the types in the entries of the other functions in others.
+func (t topology) unmatched(
+	types, others map[*function][]reflect.Type,
+	match func(a, b reflect.Type) bool,
+) map[*function][]reflect.Type {
+	unmatched := map[*function][]reflect.Type{}
+
+	for _, f := range t.Functions {
+		for _, a := range types[f] {
+			if !t.isMatched(f, a, others, match) {
+				unmatched[f] = append(unmatched[f], a)
+			}
+		}
+	}
+
+	return unmatched
+}
+
+// isMatched returns true if a matches any of the types in the entries of the
+// functions in others that may exchange messages with f.
+func (t topology) isMatched(
+	f *function,
+	a reflect.Type,
+	others map[*function][]reflect.Type,
+	match func(a, b reflect.Type) bool,
+) bool {
+	for _, g := range t.Functions {
+		// A function only receives its own messages if it uses self-delivery.
+		if g == f && !f.SelfDelivery {
+			continue
+		}
+
+		for _, b := range others[g] {
+			if match(a, b) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// RequireSubscribers returns an error that wraps [ErrNoSubscribers] if any
+// function declares that it sends a type that no function subscribes to.
+func (t topology) RequireSubscribers() error {
+	unsubscribed := t.Unsubscribed()
+
+	var problems []string
+
+	for _, f := range t.Functions {
+		for _, mt := range unsubscribed[f] {
+			problems = append(problems, fmt.Sprintf("%s, published by %q", mt, f.Name))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrNoSubscribers, strings.Join(problems, "; "))
+}
+
+// warnTopology logs a warning for each type that a function declares that it
+// sends but that no function subscribes to. If publications are strict, and so
+// are declared by every function that sends messages, it also warns about each
+// type that a function subscribes to but that no function declares.
+func warnTopology(ctx context.Context, cfg *config, t topology) {
+	unsubscribed := t.Unsubscribed()
+
+	for _, f := range t.Functions {
+		for _, mt := range unsubscribed[f] {
+			f.warn(ctx, "published type has no subscribers", slog.String("message_type", mt.String()))
+		}
+	}
+
+	if !cfg.StrictPublications {
+		return
+	}
+
+	unpublished := t.Unpublished()
+
+	for _, f := range t.Functions {
+		for _, mt := range unpublished[f] {
+			f.warn(ctx, "subscribed type is not published", slog.String("message_type", mt.String()))
+		}
+	}
+}
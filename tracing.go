@@ -0,0 +1,64 @@
+package minibus
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ReceivedSpanContext returns the OpenTelemetry span context of the delivery
+// of the message that the calling function most recently received.
+//
+// It may be used as the parent of any spans that the function records while
+// handling the message, for example:
+//
+//	ctx = trace.ContextWithSpanContext(ctx, minibus.ReceivedSpanContext(ctx))
+//
+// It returns an invalid span context if the [WithTracer] option is not used,
+// or if the function has not received any messages.
+//
+// It may only be called within a function that has been called by [Run].
+func ReceivedSpanContext(ctx context.Context) trace.SpanContext {
+	env, _ := caller(ctx).Received()
+	return env.SpanContext
+}
+
+// startPublishSpan starts a span that represents f publishing m. It returns
+// the envelope to send, which carries the span's context.
+func (f *function) startPublishSpan(ctx context.Context, m any) (envelope, trace.Span) {
+	env := envelopeOf(m)
+
+	_, span := f.Config.Tracer.Start(
+		ctx,
+		"minibus.publish "+env.Type.String(),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("minibus.function", f.Name),
+			attribute.String("minibus.message_type", env.Type.String()),
+		),
+	)
+
+	env.SpanContext = span.SpanContext()
+
+	return env, span
+}
+
+// startDeliverSpan starts a span that represents env being delivered to f, as
+// a child of env's publish span. It returns a copy of env that carries the new
+// span's context.
+func (f *function) startDeliverSpan(ctx context.Context, env envelope) (envelope, trace.Span) {
+	_, span := f.Config.Tracer.Start(
+		trace.ContextWithSpanContext(ctx, env.SpanContext),
+		"minibus.deliver "+env.Type.String(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("minibus.function", f.Name),
+			attribute.String("minibus.message_type", env.Type.String()),
+		),
+	)
+
+	env.SpanContext = span.SpanContext()
+
+	return env, span
+}
@@ -0,0 +1,91 @@
+package minibus_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWithTracer(t *testing.T) {
+	t.Run("it records publish and delivery spans for each message", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		tracer := provider.Tracer("<tracer>")
+
+		var (
+			parent   trace.SpanContext
+			received trace.SpanContext
+		)
+
+		err := Run(
+			ctx,
+			WithTracer(tracer),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+
+					received = ReceivedSpanContext(ctx)
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					ctx, span := tracer.Start(ctx, "<parent>")
+					defer span.End()
+
+					parent = span.SpanContext()
+					return Send(ctx, "<message>")
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		spans := map[string]sdktrace.ReadOnlySpan{}
+		for _, s := range recorder.Ended() {
+			spans[s.Name()] = s
+		}
+
+		publish, ok := spans["minibus.publish string"]
+		if !ok {
+			t.Fatal("expected a publish span")
+		}
+
+		deliver, ok := spans["minibus.deliver string"]
+		if !ok {
+			t.Fatal("expected a delivery span")
+		}
+
+		if publish.Parent().SpanID() != parent.SpanID() {
+			t.Fatal("expected the publish span to be a child of the sender's span")
+		}
+
+		if deliver.Parent().SpanID() != publish.SpanContext().SpanID() {
+			t.Fatal("expected the delivery span to be a child of the publish span")
+		}
+
+		if deliver.SpanContext().TraceID() != parent.TraceID() {
+			t.Fatal("expected the delivery span to belong to the sender's trace")
+		}
+
+		if !received.Equal(deliver.SpanContext()) {
+			t.Fatal("expected ReceivedSpanContext() to return the delivery span's context")
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package minibus
+
+import "context"
+
+// contextValue is a value captured from the context of the sender of a
+// message.
+type contextValue struct {
+	Key, Value any
+}
+
+// MessageContext returns a context derived from ctx that carries the values
+// propagated from the sender's context with the message that the calling
+// function most recently received.
+//
+// Only the values of the keys passed to the [WithContextValues] option are
+// propagated. It returns ctx unchanged if the function has not received any
+// messages, or if none of those values were present in the sender's context.
+//
+// It may only be called within a function that has been called by [Run].
+func MessageContext(ctx context.Context) context.Context {
+	env, _ := caller(ctx).Received()
+
+	for _, v := range env.Values {
+		ctx = context.WithValue(ctx, v.Key, v.Value)
+	}
+
+	return ctx
+}
+
+// captureContextValues returns the envelope for m, carrying the values of f's
+// context keys that are present in ctx.
+func (f *function) captureContextValues(ctx context.Context, m any) envelope {
+	env := envelopeOf(m)
+
+	for _, k := range f.Config.ContextKeys {
+		if v := ctx.Value(k); v != nil {
+			env.Values = append(env.Values, contextValue{k, v})
+		}
+	}
+
+	return env
+}
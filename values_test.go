@@ -0,0 +1,139 @@
+package minibus_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/minibus"
+)
+
+type (
+	propagatedKey    struct{}
+	notPropagatedKey struct{}
+)
+
+func TestWithContextValues(t *testing.T) {
+	t.Run("it propagates the values of the given keys from the sender to the recipient", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var (
+			propagated    any
+			notPropagated any
+		)
+
+		err := Run(
+			ctx,
+			WithContextValues(propagatedKey{}),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+
+					ctx = MessageContext(ctx)
+					propagated = ctx.Value(propagatedKey{})
+					notPropagated = ctx.Value(notPropagatedKey{})
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+
+					ctx = context.WithValue(ctx, propagatedKey{}, "<propagated>")
+					ctx = context.WithValue(ctx, notPropagatedKey{}, "<not-propagated>")
+
+					return Send(ctx, "<message>")
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		if propagated != "<propagated>" {
+			t.Fatalf("unexpected propagated value: got %v, want %q", propagated, "<propagated>")
+		}
+
+		if notPropagated != nil {
+			t.Fatalf("unexpected value for key that was not propagated: got %v, want nil", notPropagated)
+		}
+	})
+
+	t.Run("it returns the calling function's context if the message has no propagated values", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		err := Run(
+			ctx,
+			WithContextValues(propagatedKey{}),
+			WithFunc(
+				func(ctx context.Context) error {
+					Subscribe[string](ctx)
+					Ready(ctx)
+
+					if _, err := Receive(ctx); err != nil {
+						return err
+					}
+
+					if MessageContext(ctx) != ctx {
+						t.Error("expected MessageContext() to return the calling function's context")
+					}
+
+					return nil
+				},
+			),
+			WithFunc(
+				func(ctx context.Context) error {
+					Ready(ctx)
+					return Send(ctx, "<message>")
+				},
+			),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+	})
+}
+
+func TestWithContext(t *testing.T) {
+	t.Run("it applies the function to the context of every function", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		var values [2]any
+
+		fn := func(i int) Func {
+			return func(ctx context.Context) error {
+				values[i] = ctx.Value(propagatedKey{})
+				return nil
+			}
+		}
+
+		err := Run(
+			ctx,
+			WithContext(
+				func(ctx context.Context) context.Context {
+					return context.WithValue(ctx, propagatedKey{}, "<value>")
+				},
+			),
+			WithFunc(fn(0)),
+			WithFunc(fn(1)),
+		)
+		if err != nil {
+			t.Fatalf("Run() returned an unexpected error: %s", err)
+		}
+
+		for i, v := range values {
+			if v != "<value>" {
+				t.Fatalf("unexpected value in the context of function %d: got %v, want %q", i, v, "<value>")
+			}
+		}
+	})
+}